@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/buffers"
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+)
+
+type BuffersRequest struct {
+	WorkspacePath string           `json:"workspace_path"`
+	Buffers       []buffers.Buffer `json:"buffers"`
+}
+
+type BuffersResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// handleBuffers records the editor's open buffers and what is visible of them
+func (s *server) handleBuffers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BuffersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Error decoding buffers request", "error", err)
+		json.NewEncoder(w).Encode(BuffersResponse{Error: err.Error()})
+		return
+	}
+
+	s.openBuffers.Report(req.WorkspacePath, req.Buffers, time.Now())
+	logger.Debug("Open buffers reported", "workspace_path", req.WorkspacePath, "buffers", len(req.Buffers))
+	json.NewEncoder(w).Encode(BuffersResponse{})
+}
+
+// additionalFilesFor picks the open and recently viewed files to send with a request
+// for filePath.
+func (s *server) additionalFilesFor(workspacePath, filePath string) []completion.AdditionalFile {
+	if s.additionalFilesBudget < 0 {
+		return nil
+	}
+	contents := func(path string) (string, bool) {
+		doc, ok := s.documents.Get(workspacePath, path)
+		if !ok {
+			return "", false
+		}
+		return doc.Contents, true
+	}
+	files := s.openBuffers.Select(workspacePath, filePath, contents, s.maxAdditionalFiles, s.additionalFilesBudget)
+
+	out := make([]completion.AdditionalFile, 0, len(files))
+	for _, file := range files {
+		additional := completion.AdditionalFile{Path: file.Path, IsOpen: file.IsOpen, LastViewed: file.LastViewed}
+		for _, r := range file.Ranges {
+			additional.Ranges = append(additional.Ranges, completion.VisibleRange{StartLine: r.StartLine, EndLine: r.EndLine, Lines: r.Lines})
+		}
+		out = append(out, additional)
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/config"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+	"github.com/bengu3/cursor-tab.nvim/internal/fim"
+)
+
+// loadConfig reads the config file, treating a missing file at the default path as empty
+func loadConfig(path string) (*config.Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = config.DefaultPath()
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// resolveUpstream picks the API base URL and fallbacks: flags first, then the
+// environment, then the config file.
+func resolveUpstream(cfg *config.Config, flagBaseURL, flagFallbacks string) (string, []string) {
+	baseURL := firstNonEmpty(flagBaseURL, os.Getenv("CURSOR_TAB_BASE_URL"), cfg.Upstream.BaseURL)
+
+	fallbacks := cfg.Upstream.FallbackURLs
+	if list := firstNonEmpty(flagFallbacks, os.Getenv("CURSOR_TAB_FALLBACK_URLS")); list != "" {
+		fallbacks = strings.Split(list, ",")
+	}
+
+	return baseURL, fallbacks
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// defaultCredentialSources is the order credential providers are tried in when
+// neither --credential-sources nor the config file sets one.
+var defaultCredentialSources = []string{"env", "token-file", "config", "vscdb"}
+
+// buildCredentialChain turns a list of source names into a provider chain.
+// Sources that were not explicitly requested and have nothing configured are skipped.
+// CURSOR_MACHINE_ID or credentials.machine_id supply the machine ID for sources without one.
+func buildCredentialChain(sources []string, tokenFile string, cfg *config.Config) (cursor.CredentialProvider, error) {
+	explicit := len(sources) > 0
+	if !explicit {
+		sources = defaultCredentialSources
+	}
+
+	var chain cursor.CredentialChain
+	for _, source := range sources {
+		switch strings.TrimSpace(source) {
+		case "env":
+			chain = append(chain, cursor.EnvProvider{})
+		case "token-file":
+			if tokenFile != "" || explicit {
+				chain = append(chain, cursor.TokenFileProvider{Path: tokenFile})
+			}
+		case "config":
+			if cfg.Credentials.AccessToken != "" || explicit {
+				chain = append(chain, cursor.StaticProvider{
+					Source:      "config",
+					AccessToken: cfg.Credentials.AccessToken,
+					MachineID:   cfg.Credentials.MachineID,
+				})
+			}
+		case "vscdb":
+			chain = append(chain, cursor.StateDBProvider{})
+		default:
+			return nil, fmt.Errorf("unknown credential source %q", source)
+		}
+	}
+
+	return cursor.MachineIDProvider{
+		CredentialProvider: chain,
+		MachineID:          firstNonEmpty(strings.TrimSpace(os.Getenv("CURSOR_MACHINE_ID")), cfg.Credentials.MachineID),
+		Derive:             cfg.Credentials.DeriveMachineID,
+	}, nil
+}
+
+// resolveTransport applies the --proxy and --ca-file flags on top of the config file.
+func resolveTransport(cfg *config.Config, flagProxy, flagCAFile string) cursor.TransportOptions {
+	t := cfg.Transport
+	opts := cursor.TransportOptions{
+		ProxyURL:            firstNonEmpty(flagProxy, t.ProxyURL),
+		NoProxy:             t.NoProxy,
+		CAFiles:             t.CAFiles,
+		ClientCertFile:      t.ClientCert,
+		ClientKeyFile:       t.ClientKey,
+		DialTimeout:         time.Duration(t.DialTimeoutMs) * time.Millisecond,
+		TLSHandshakeTimeout: time.Duration(t.TLSHandshakeTimeoutMs) * time.Millisecond,
+		FirstByteTimeout:    time.Duration(t.FirstByteTimeoutMs) * time.Millisecond,
+		WarmAfterIdle:       time.Duration(t.WarmAfterIdleSeconds) * time.Second,
+	}
+	if flagCAFile != "" {
+		opts.CAFiles = append([]string{flagCAFile}, opts.CAFiles...)
+	}
+	return opts
+}
+
+// resolveBackends picks the backend names from --backend, falling back to the config file.
+func resolveBackends(cfg *config.Config, flagBackend string) []string {
+	if flagBackend != "" {
+		return strings.Split(flagBackend, ",")
+	}
+	if len(cfg.Backends) > 0 {
+		return cfg.Backends
+	}
+	return []string{cfg.Backend}
+}
+
+// buildCompleter returns the named backend, or a race between them if there are several.
+func buildCompleter(names []string, cfg *config.Config) (completion.Completer, error) {
+	completers := make([]completion.Completer, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		c, err := newCompleter(strings.TrimSpace(name), cfg)
+		if err != nil {
+			return nil, err
+		}
+		if seen[c.Name()] {
+			return nil, fmt.Errorf("backend %q listed twice", c.Name())
+		}
+		seen[c.Name()] = true
+		completers = append(completers, c)
+	}
+	if len(completers) == 1 {
+		return completers[0], nil
+	}
+	return completion.NewRace(logger, completers...), nil
+}
+
+func usesCursor(backends []string) bool {
+	for _, name := range backends {
+		if name = strings.TrimSpace(name); name == "" || name == cursor.CompleterName {
+			return true
+		}
+	}
+	return false
+}
+
+// newCompleter returns the completion backend called name.
+func newCompleter(name string, cfg *config.Config) (completion.Completer, error) {
+	switch name {
+	case "", cursor.CompleterName:
+		return cursorManager, nil
+	case fim.CompleterName:
+		var httpClient *http.Client
+		if cfg.FIM.TimeoutMs > 0 {
+			httpClient = &http.Client{Timeout: time.Duration(cfg.FIM.TimeoutMs) * time.Millisecond}
+		}
+		return fim.NewClient(fim.Options{
+			BaseURL:     cfg.FIM.BaseURL,
+			Model:       cfg.FIM.Model,
+			APIKey:      cfg.FIM.APIKey,
+			Template:    cfg.FIM.Template,
+			MaxTokens:   cfg.FIM.MaxTokens,
+			Temperature: cfg.FIM.Temperature,
+			Stop:        cfg.FIM.Stop,
+			PrefixLines: cfg.FIM.PrefixLines,
+			SuffixLines: cfg.FIM.SuffixLines,
+			HTTPClient:  httpClient,
+			Logger:      logger,
+		})
+	}
+	return nil, fmt.Errorf("unknown backend %q", name)
+}
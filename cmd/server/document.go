@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/document"
+)
+
+type OpenDocumentRequest struct {
+	WorkspacePath string `json:"workspace_path"`
+	FilePath      string `json:"file_path"`
+	LanguageID    string `json:"language_id"`
+	Version       int32  `json:"version"`
+	Contents      string `json:"contents"`
+}
+
+type ChangeDocumentRequest struct {
+	WorkspacePath string            `json:"workspace_path"`
+	FilePath      string            `json:"file_path"`
+	Version       int32             `json:"version"`
+	Changes       []document.Change `json:"changes"`
+}
+
+type CloseDocumentRequest struct {
+	WorkspacePath string `json:"workspace_path"`
+	FilePath      string `json:"file_path"`
+}
+
+type DocumentResponse struct {
+	Version   int32  `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// completionDocument gives a backend the synced document and its recent changes.
+func completionDocument(doc *document.Snapshot) *completion.Document {
+	changes := make([]completion.DocumentChange, len(doc.Changes))
+	for i, c := range doc.Changes {
+		changes[i] = completion.DocumentChange{
+			Version:  c.Version,
+			Start:    c.Start,
+			End:      c.End,
+			StartPos: completion.Position{Line: int32(c.StartPos.Line), Column: int32(c.StartPos.Character)},
+			EndPos:   completion.Position{Line: int32(c.EndPos.Line), Column: int32(c.EndPos.Character)},
+			Text:     c.Text,
+			Length:   c.Length,
+			UTF16:    completion.UTF16Offsets(c.UTF16),
+		}
+	}
+	return &completion.Document{
+		Workspace:   doc.Workspace,
+		Path:        doc.Path,
+		Version:     doc.Version,
+		Contents:    doc.Contents,
+		Changes:     changes,
+		ChangesFrom: doc.ChangesFrom,
+	}
+}
+
+// documentErrorCode tells the editor to re-open a document with its full contents.
+func documentErrorCode(err error) string {
+	if errors.Is(err, document.ErrNotOpen) || errors.Is(err, document.ErrVersionMismatch) {
+		return "version_mismatch"
+	}
+	return ""
+}
+
+// decodeDocumentRequest rejects anything but a POST with a valid body.
+func decodeDocumentRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		logger.Error("Error decoding document request", "path", r.URL.Path, "error", err)
+		json.NewEncoder(w).Encode(DocumentResponse{Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+func (s *server) handleOpenDocument(w http.ResponseWriter, r *http.Request) {
+	var req OpenDocumentRequest
+	if !decodeDocumentRequest(w, r, &req) {
+		return
+	}
+
+	s.documents.Open(req.WorkspacePath, req.FilePath, req.LanguageID, req.Version, req.Contents)
+	logger.Debug("Document opened", "file_path", req.FilePath, "version", req.Version, "content_length", len(req.Contents))
+	json.NewEncoder(w).Encode(DocumentResponse{Version: req.Version})
+}
+
+func (s *server) handleChangeDocument(w http.ResponseWriter, r *http.Request) {
+	var req ChangeDocumentRequest
+	if !decodeDocumentRequest(w, r, &req) {
+		return
+	}
+
+	doc, err := s.documents.Change(req.WorkspacePath, req.FilePath, req.Version, req.Changes)
+	if err != nil {
+		logger.Warn("Rejected document change", "file_path", req.FilePath, "version", req.Version, "error", err)
+		json.NewEncoder(w).Encode(DocumentResponse{Error: err.Error(), ErrorCode: documentErrorCode(err)})
+		return
+	}
+	json.NewEncoder(w).Encode(DocumentResponse{Version: doc.Version})
+}
+
+func (s *server) handleCloseDocument(w http.ResponseWriter, r *http.Request) {
+	var req CloseDocumentRequest
+	if !decodeDocumentRequest(w, r, &req) {
+		return
+	}
+
+	s.documents.Close(req.WorkspacePath, req.FilePath)
+	logger.Debug("Document closed", "file_path", req.FilePath)
+	json.NewEncoder(w).Encode(DocumentResponse{})
+}
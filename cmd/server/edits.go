@@ -0,0 +1,19 @@
+package main
+
+import "github.com/bengu3/cursor-tab.nvim/internal/completion"
+
+// recentEdits returns the edit history of the files in workspacePath, least recently
+// edited first.
+func (s *server) recentEdits(workspacePath string) []completion.FileEdits {
+	files := s.edits.History(workspacePath)
+
+	out := make([]completion.FileEdits, len(files))
+	for i, file := range files {
+		diffs := make([]completion.Diff, len(file.Diffs))
+		for j, diff := range file.Diffs {
+			diffs[j] = completion.Diff{Text: diff.Text, At: diff.At}
+		}
+		out[i] = completion.FileEdits{Path: file.Path, Diffs: diffs, Merged: file.Merged}
+	}
+	return out
+}
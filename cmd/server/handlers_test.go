@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/buffers"
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/document"
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+// fakeCompleter answers every request with the same events and remembers the requests.
+type fakeCompleter struct {
+	events []completion.Event
+	err    error
+
+	mu       sync.Mutex
+	requests []*completion.Request
+}
+
+func (f *fakeCompleter) Name() string { return "fake" }
+
+func (f *fakeCompleter) Complete(ctx context.Context, req *completion.Request) (completion.Stream, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &fakeStream{events: f.events}, nil
+}
+
+func (f *fakeCompleter) last(t *testing.T) *completion.Request {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		t.Fatal("completer was not called")
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+type fakeStream struct {
+	events []completion.Event
+	event  completion.Event
+}
+
+func (s *fakeStream) Receive() bool {
+	if len(s.events) == 0 {
+		return false
+	}
+	s.event, s.events = s.events[0], s.events[1:]
+	return true
+}
+
+func (s *fakeStream) Event() completion.Event { return s.event }
+func (s *fakeStream) Err() error              { return nil }
+func (s *fakeStream) Close() error            { return nil }
+
+// oneEdit is a stream with a single edit of line 1.
+var oneEdit = []completion.Event{
+	{Kind: completion.EventRange, Range: &suggestionstore.RangeInfo{StartLine: 1, EndLine: 1}},
+	{Kind: completion.EventText, Text: "edited"},
+	{Kind: completion.EventDoneEdit},
+	{Kind: completion.EventDoneStream},
+}
+
+func newFakeServer(t *testing.T, completer *fakeCompleter) *httptest.Server {
+	t.Helper()
+	httpServer := httptest.NewServer(newServer(completer, nil).routes())
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func post(t *testing.T, url string, body, out any) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("decoding %s response: %v", url, err)
+	}
+}
+
+func TestNewSuggestionRequest(t *testing.T) {
+	completer := &fakeCompleter{events: oneEdit}
+	srv := newFakeServer(t, completer)
+
+	req := testRequest
+	req.Diagnostics = []completion.Diagnostic{
+		{Message: "undefined: x", Severity: completion.SeverityError, Range: completion.Range{
+			Start: completion.Position{Line: 2, Column: 1},
+			End:   completion.Position{Line: 2, Column: 2},
+		}},
+		{Message: ""},
+	}
+	got := postSuggestion(t, srv.URL, req)
+	if got.Suggestion != "edited" {
+		t.Errorf("suggestion = %q, want %q", got.Suggestion, "edited")
+	}
+
+	sent := completer.last(t)
+	if sent.FilePath != req.FilePath || sent.WorkspacePath != req.WorkspacePath || sent.FileContents != req.FileContents {
+		t.Errorf("request = %+v, want the file from %+v", sent, req)
+	}
+	if sent.Line != req.Line || sent.Column != req.Column || sent.LanguageID != req.LanguageID {
+		t.Errorf("cursor = %d:%d %s, want %d:%d %s", sent.Line, sent.Column, sent.LanguageID, req.Line, req.Column, req.LanguageID)
+	}
+	if len(sent.Diagnostics) != 1 || sent.Diagnostics[0].Message != "undefined: x" {
+		t.Errorf("diagnostics = %+v, want the one with a message", sent.Diagnostics)
+	}
+	if sent.Document != nil {
+		t.Errorf("document = %+v, want none without a version", sent.Document)
+	}
+}
+
+func TestNewSuggestionRecentEdits(t *testing.T) {
+	completer := &fakeCompleter{events: oneEdit}
+	srv := newFakeServer(t, completer)
+
+	postSuggestion(t, srv.URL, testRequest)
+	if edits := completer.last(t).RecentEdits; len(edits) != 0 {
+		t.Errorf("recent edits after the first request = %+v, want none", edits)
+	}
+
+	req := testRequest
+	req.FileContents = "package main\n\nfunc main() {\n\tprintln()\n}\n"
+	postSuggestion(t, srv.URL, req)
+
+	edits := completer.last(t).RecentEdits
+	if len(edits) != 1 || edits[0].Path != req.FilePath || len(edits[0].Diffs) != 1 {
+		t.Fatalf("recent edits = %+v, want one diff of %s", edits, req.FilePath)
+	}
+	if !strings.Contains(edits[0].Diffs[0].Text, "+\tprintln()") {
+		t.Errorf("diff = %q, want the added line", edits[0].Diffs[0].Text)
+	}
+}
+
+func TestNewSuggestionSyncedDocument(t *testing.T) {
+	completer := &fakeCompleter{events: oneEdit}
+	srv := newFakeServer(t, completer)
+
+	var resp DocumentResponse
+	post(t, srv.URL+"/document/open", OpenDocumentRequest{
+		WorkspacePath: "/work", FilePath: "main.go", LanguageID: "go", Version: 1, Contents: "package main\n",
+	}, &resp)
+	post(t, srv.URL+"/document/change", ChangeDocumentRequest{
+		WorkspacePath: "/work", FilePath: "main.go", Version: 2,
+		Changes: []document.Change{{
+			Range: &document.Range{Start: document.Position{Line: 1}, End: document.Position{Line: 1}},
+			Text:  "\nfunc main() {}\n",
+		}},
+	}, &resp)
+	if resp.Error != "" || resp.Version != 2 {
+		t.Fatalf("change response = %+v", resp)
+	}
+
+	version := int32(2)
+	postSuggestion(t, srv.URL, NewSuggestionRequest{WorkspacePath: "/work", FilePath: "main.go", Version: &version})
+
+	sent := completer.last(t)
+	if want := "package main\n\nfunc main() {}\n"; sent.FileContents != want {
+		t.Errorf("contents = %q, want %q", sent.FileContents, want)
+	}
+	if sent.LanguageID != "go" {
+		t.Errorf("language = %q, want the synced one", sent.LanguageID)
+	}
+	if sent.Document == nil || sent.Document.Version != 2 {
+		t.Fatalf("document = %+v, want version 2", sent.Document)
+	}
+	changes, ok := sent.Document.ChangesSince(1)
+	if !ok || len(changes) != 1 || changes[0].Text != "\nfunc main() {}\n" {
+		t.Errorf("changes since 1 = %+v, %v, want the one change", changes, ok)
+	}
+}
+
+func TestNewSuggestionUnknownVersion(t *testing.T) {
+	completer := &fakeCompleter{events: oneEdit}
+	srv := newFakeServer(t, completer)
+
+	version := int32(7)
+	got := postSuggestion(t, srv.URL, NewSuggestionRequest{WorkspacePath: "/work", FilePath: "main.go", Version: &version})
+	if got.ErrorCode != "version_mismatch" {
+		t.Errorf("response = %+v, want a version mismatch", got)
+	}
+	if len(completer.requests) != 0 {
+		t.Errorf("completer called %d times, want none", len(completer.requests))
+	}
+}
+
+func TestNewSuggestionAdditionalFiles(t *testing.T) {
+	completer := &fakeCompleter{events: oneEdit}
+	srv := newFakeServer(t, completer)
+
+	var resp BuffersResponse
+	post(t, srv.URL+"/workspace/buffers", BuffersRequest{
+		WorkspacePath: "/work",
+		Buffers: []buffers.Buffer{
+			{FilePath: "main.go", VisibleRanges: []buffers.Range{{StartLine: 1, EndLine: 2, Lines: []string{"package main", ""}}}},
+			{FilePath: "util.go", VisibleRanges: []buffers.Range{{StartLine: 1, EndLine: 1, Lines: []string{"package util"}}}},
+		},
+	}, &resp)
+	if resp.Error != "" {
+		t.Fatalf("buffers response = %+v", resp)
+	}
+
+	postSuggestion(t, srv.URL, testRequest)
+
+	files := completer.last(t).AdditionalFiles
+	if len(files) != 1 || files[0].Path != "util.go" || !files[0].IsOpen {
+		t.Fatalf("additional files = %+v, want the open util.go only", files)
+	}
+	if len(files[0].Ranges) != 1 || files[0].Ranges[0].Lines[0] != "package util" {
+		t.Errorf("ranges = %+v, want the visible line", files[0].Ranges)
+	}
+}
+
+func TestNewSuggestionCompleterError(t *testing.T) {
+	completer := &fakeCompleter{err: errors.New("backend down")}
+	srv := newFakeServer(t, completer)
+
+	got := postSuggestion(t, srv.URL, testRequest)
+	if got.Error != "backend down" || got.Suggestion != "" {
+		t.Errorf("response = %+v, want the backend error", got)
+	}
+}
+
+func TestNewSuggestionEmptyStream(t *testing.T) {
+	completer := &fakeCompleter{events: []completion.Event{{Kind: completion.EventDoneStream}}}
+	srv := newFakeServer(t, completer)
+
+	got := postSuggestion(t, srv.URL, testRequest)
+	if got.Error != "no suggestion returned" {
+		t.Errorf("response = %+v, want no suggestion", got)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+)
+
+// Lines around the cursor used as the index query.
+const (
+	queryLinesBefore = 10
+	queryLinesAfter  = 5
+)
+
+// relatedChunks looks up code in the workspace that resembles the text around the cursor.
+func (s *server) relatedChunks(req NewSuggestionRequest) []completion.Chunk {
+	if s.workspaceIndex == nil {
+		return nil
+	}
+	lines := strings.Split(req.FileContents, "\n")
+	start := max(int(req.Line)-queryLinesBefore, 0)
+	end := min(int(req.Line)+queryLinesAfter+1, len(lines))
+	if start >= end {
+		return nil
+	}
+	hits := s.workspaceIndex.Search(req.WorkspacePath, req.FilePath, strings.Join(lines[start:end], "\n"))
+
+	chunks := make([]completion.Chunk, len(hits))
+	for i, hit := range hits {
+		chunks[i] = completion.Chunk{Path: hit.Path, StartLine: hit.StartLine, EndLine: hit.EndLine, Content: hit.Content, Score: hit.Score}
+	}
+	return chunks
+}
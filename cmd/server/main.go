@@ -3,24 +3,31 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
-	"connectrpc.com/connect"
-	"github.com/google/uuid"
-	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+	"github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1/aiserverv1connect"
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
 	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+	"github.com/bengu3/cursor-tab.nvim/internal/document"
+	"github.com/bengu3/cursor-tab.nvim/internal/fakeupstream"
+	"github.com/bengu3/cursor-tab.nvim/internal/index"
 	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+	"github.com/google/uuid"
 )
 
-var cursorClient *cursor.Client
-var store = suggestionstore.NewStore()
+// backgroundStreamTimeout bounds how long the rest of a multi-edit stream is read
+// after the first suggestion has been returned.
+const backgroundStreamTimeout = 30 * time.Second
+
+var cursorManager *cursor.Manager
 var logger *slog.Logger
 
 type NewSuggestionRequest struct {
@@ -30,15 +37,21 @@ type NewSuggestionRequest struct {
 	FilePath      string `json:"file_path"`
 	LanguageID    string `json:"language_id"`
 	WorkspacePath string `json:"workspace_path"`
+	// Version, if set, names a document synced through /document/*; FileContents may
+	// then be left empty.
+	Version *int32 `json:"version,omitempty"`
+	// Diagnostics are the editor's diagnostics for the file.
+	Diagnostics []completion.Diagnostic `json:"diagnostics,omitempty"`
 }
 
 type SuggestionResponse struct {
-	Suggestion             string                 `json:"suggestion"`
-	Error                  string                 `json:"error,omitempty"`
-	RangeReplace           *suggestionstore.RangeInfo   `json:"range_replace,omitempty"`
-	NextSuggestionID       string                 `json:"next_suggestion_id,omitempty"`
-	BindingID              string                 `json:"binding_id,omitempty"`
-	ShouldRemoveLeadingEol bool                   `json:"should_remove_leading_eol,omitempty"`
+	Suggestion             string                     `json:"suggestion"`
+	Error                  string                     `json:"error,omitempty"`
+	ErrorCode              string                     `json:"error_code,omitempty"`
+	RangeReplace           *suggestionstore.RangeInfo `json:"range_replace,omitempty"`
+	NextSuggestionID       string                     `json:"next_suggestion_id,omitempty"`
+	BindingID              string                     `json:"binding_id,omitempty"`
+	ShouldRemoveLeadingEol bool                       `json:"should_remove_leading_eol,omitempty"`
 }
 
 // generateSuggestionID creates a unique suggestion ID using UUID
@@ -46,7 +59,7 @@ func generateSuggestionID() string {
 	return fmt.Sprintf("sugg_%s", uuid.New().String())
 }
 
-func handleNewSuggestion(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleNewSuggestion(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -59,6 +72,21 @@ func handleNewSuggestion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var doc *completion.Document
+	if req.Version != nil {
+		if synced, ok := s.documents.Get(req.WorkspacePath, req.FilePath); ok && synced.Version == *req.Version {
+			doc = completionDocument(synced)
+			req.FileContents = synced.Contents
+			if req.LanguageID == "" {
+				req.LanguageID = synced.LanguageID
+			}
+		} else if req.FileContents == "" {
+			logger.Warn("Suggestion request for unknown document version", "file_path", req.FilePath, "version", *req.Version)
+			json.NewEncoder(w).Encode(SuggestionResponse{Error: document.ErrVersionMismatch.Error(), ErrorCode: "version_mismatch"})
+			return
+		}
+	}
+
 	logger.Info("New suggestion request",
 		"file_path", req.FilePath,
 		"line", req.Line,
@@ -66,54 +94,62 @@ func handleNewSuggestion(w http.ResponseWriter, r *http.Request) {
 		"language_id", req.LanguageID,
 		"workspace_path", req.WorkspacePath,
 		"content_length", len(req.FileContents),
+		"diagnostics", len(req.Diagnostics),
 	)
 
-	if cursorClient == nil {
-		json.NewEncoder(w).Encode(SuggestionResponse{Error: "cursor client not initialized"})
-		return
-	}
-
-	lines := strings.Split(req.FileContents, "\n")
-	totalLines := int32(len(lines))
-
-	giveDebug := true
-	supportsCpt := true
-	supportsCrlfCpt := true
-	streamReq := &aiserverv1.StreamCppRequest{
-		CurrentFile: &aiserverv1.CurrentFileInfo{
-			Contents:              req.FileContents,
-			RelativeWorkspacePath: req.FilePath,
-			LanguageId:            req.LanguageID,
-			TotalNumberOfLines:    totalLines,
-			WorkspaceRootPath:     req.WorkspacePath,
-			CursorPosition: &aiserverv1.CursorPosition{
-				Line:   req.Line,
-				Column: req.Column,
-			},
-		},
-		CppIntentInfo: &aiserverv1.CppIntentInfo{
-			Source: "typing",
-		},
-		SupportsCpt:     &supportsCpt,
-		SupportsCrlfCpt: &supportsCrlfCpt,
-		GiveDebugOutput: &giveDebug,
-	}
-
+	// Suggestions after the first are stored in the background once this request has
+	// returned, so the stream gets its own context that follows the request only
+	// until then.
 	ctx := r.Context()
-	stream, err := cursorClient.StreamCpp(ctx, streamReq)
+	streamCtx, cancelStream := context.WithTimeout(context.WithoutCancel(ctx), backgroundStreamTimeout)
+	stopFollowingRequest := context.AfterFunc(ctx, cancelStream)
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			cancelStream()
+		}
+	}()
+
+	s.edits.Observe(req.WorkspacePath, req.FilePath, req.FileContents, time.Now())
+
+	stream, err := s.completer.Complete(streamCtx, &completion.Request{
+		FilePath:        req.FilePath,
+		WorkspacePath:   req.WorkspacePath,
+		LanguageID:      req.LanguageID,
+		FileContents:    req.FileContents,
+		Line:            req.Line,
+		Column:          req.Column,
+		RecentEdits:     s.recentEdits(req.WorkspacePath),
+		Document:        doc,
+		Diagnostics:     completion.NormalizeDiagnostics(req.Diagnostics, req.FileContents, req.Line),
+		AdditionalFiles: s.additionalFilesFor(req.WorkspacePath, req.FilePath),
+		RelatedChunks:   s.relatedChunks(req),
+	})
 	if err != nil {
 		// Check if request was cancelled
 		if ctx.Err() == context.Canceled {
 			logger.Info("Request cancelled")
 			return
 		}
-		logger.Error("Failed to stream from Cursor API", "error", err)
+		if errors.Is(err, cursor.ErrCircuitOpen) {
+			logger.Warn("Skipping Cursor API call, circuit breaker open", "error", err)
+			json.NewEncoder(w).Encode(SuggestionResponse{Error: err.Error(), ErrorCode: "circuit_open"})
+			return
+		}
+		logger.Error("Failed to start completion", "backend", s.completer.Name(), "error", err)
 		json.NewEncoder(w).Encode(SuggestionResponse{Error: err.Error()})
 		return
 	}
 
-	// Parse first suggestion using new early return pattern
-	firstSuggestion, err := parseNextSuggestion(stream)
+	defer func() {
+		if !handedOff {
+			stream.Close()
+		}
+	}()
+
+	// Parse first suggestion
+	parser := completion.NewParser(stream)
+	firstSuggestion, err := parser.Next()
 	if err != nil {
 		logger.Error("Failed to parse first suggestion", "error", err)
 		json.NewEncoder(w).Encode(SuggestionResponse{Error: err.Error()})
@@ -125,29 +161,28 @@ func handleNewSuggestion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Peek at next chunk to see if there are more suggestions
-	// After DoneEdit, next chunk is either BeginEdit (more suggestions) or DoneStream (done)
+	// Look ahead to see if there are more suggestions
 	var nextSuggestionID string
-	var hasMoreSuggestions bool
-
-	if stream.Receive() {
-		resp := stream.Msg()
-
-		if resp.BeginEdit != nil && *resp.BeginEdit {
-			// There's another suggestion coming!
-			hasMoreSuggestions = true
-			nextSuggestionID = generateSuggestionID()
-
-			logger.Debug("More suggestions detected, starting background processing",
-				"next_suggestion_id", nextSuggestionID)
+	hasMoreSuggestions, err := parser.More()
+	if err != nil {
+		logger.Warn("Stream failed after first suggestion", "error", err)
+	}
 
-			// Start background processing (stream is positioned at BeginEdit)
-			go storeRemainingSuggestions(ctx, stream, nextSuggestionID)
-		} else if resp.DoneStream != nil && *resp.DoneStream {
-			// Stream is done, no more suggestions
-			hasMoreSuggestions = false
-			logger.Debug("No more suggestions, stream complete")
-		}
+	if hasMoreSuggestions {
+		nextSuggestionID = generateSuggestionID()
+
+		logger.Debug("More suggestions detected, starting background processing",
+			"next_suggestion_id", nextSuggestionID)
+
+		stopFollowingRequest()
+		handedOff = true
+		go func() {
+			defer cancelStream()
+			defer stream.Close()
+			s.storeRemainingSuggestions(streamCtx, parser, nextSuggestionID)
+		}()
+	} else {
+		logger.Debug("No more suggestions, stream complete")
 	}
 
 	// Build response
@@ -182,158 +217,9 @@ func handleNewSuggestion(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func parseSuggestions(stream *connect.ServerStreamForClient[aiserverv1.StreamCppResponse]) ([]*suggestionstore.Suggestion, error) {
-	var suggestions []*suggestionstore.Suggestion
-	var currentSuggestion *suggestionstore.Suggestion
-	chunkCount := 0
-
-	for stream.Receive() {
-		resp := stream.Msg()
-		chunkCount++
-
-		// Log entire response object structure
-		logger.Debug("Received stream chunk", "chunk_number", chunkCount, "response", fmt.Sprintf("%+v", resp))
-
-		// Log debug information if available
-		if resp.DebugModelInput != nil || resp.DebugModelOutput != nil {
-			debugAttrs := []any{}
-			if resp.DebugModelInput != nil {
-				debugAttrs = append(debugAttrs, "model_input", *resp.DebugModelInput)
-			}
-			if resp.DebugModelOutput != nil {
-				debugAttrs = append(debugAttrs, "model_output", *resp.DebugModelOutput)
-			}
-			logger.Debug("Model debug info", debugAttrs...)
-		}
-
-		// Handle different chunk types
-		if resp.RangeToReplace != nil {
-			if currentSuggestion == nil {
-				currentSuggestion = &suggestionstore.Suggestion{}
-			}
-			currentSuggestion.Range = &suggestionstore.RangeInfo{
-				StartLine:   resp.RangeToReplace.StartLineNumber,
-				StartColumn: 0,
-				EndLine:     resp.RangeToReplace.EndLineNumberInclusive,
-				EndColumn:   -1,
-			}
-			if resp.BindingId != nil {
-				currentSuggestion.BindingID = *resp.BindingId
-			}
-			if resp.ShouldRemoveLeadingEol != nil {
-				currentSuggestion.ShouldRemoveLeadingEol = *resp.ShouldRemoveLeadingEol
-			}
-		}
-
-		if resp.Text != "" {
-			if currentSuggestion == nil {
-				currentSuggestion = &suggestionstore.Suggestion{}
-			}
-			currentSuggestion.Text += resp.Text
-		}
-
-		// Done with current suggestion
-		if resp.DoneEdit != nil && *resp.DoneEdit {
-			if currentSuggestion != nil {
-				suggestions = append(suggestions, currentSuggestion)
-				logger.Info("Completed suggestion",
-					"index", len(suggestions),
-					"chars", len(currentSuggestion.Text),
-					"range", currentSuggestion.Range,
-				)
-				currentSuggestion = nil
-			}
-		}
-
-		// Beginning new suggestion
-		if resp.BeginEdit != nil && *resp.BeginEdit {
-			logger.Debug("Beginning new suggestion")
-		}
-
-		// Stream is done
-		if resp.DoneStream != nil && *resp.DoneStream {
-			logger.Debug("Stream complete")
-			break
-		}
-	}
-
-	if err := stream.Err(); err != nil && err != io.EOF {
-		return nil, fmt.Errorf("stream error: %w", err)
-	}
-
-	logger.Info("Parsed suggestions from stream", "total_suggestions", len(suggestions))
-	return suggestions, nil
-}
-
-// parseNextSuggestion reads the stream until the next DoneEdit and returns the complete suggestion.
-// Returns nil if stream ends (DoneStream) without another suggestion.
-func parseNextSuggestion(stream *connect.ServerStreamForClient[aiserverv1.StreamCppResponse]) (*suggestionstore.Suggestion, error) {
-	var currentSuggestion *suggestionstore.Suggestion
-
-	for stream.Receive() {
-		resp := stream.Msg()
-
-		// Handle range_to_replace
-		if resp.RangeToReplace != nil {
-			if currentSuggestion == nil {
-				currentSuggestion = &suggestionstore.Suggestion{}
-			}
-			currentSuggestion.Range = &suggestionstore.RangeInfo{
-				StartLine:   resp.RangeToReplace.StartLineNumber,
-				StartColumn: 0,
-				EndLine:     resp.RangeToReplace.EndLineNumberInclusive,
-				EndColumn:   -1,
-			}
-			if resp.BindingId != nil {
-				currentSuggestion.BindingID = *resp.BindingId
-			}
-			if resp.ShouldRemoveLeadingEol != nil {
-				currentSuggestion.ShouldRemoveLeadingEol = *resp.ShouldRemoveLeadingEol
-			}
-		}
-
-		// Accumulate text
-		if resp.Text != "" {
-			if currentSuggestion == nil {
-				currentSuggestion = &suggestionstore.Suggestion{}
-			}
-			currentSuggestion.Text += resp.Text
-		}
-
-		// Check for completion markers
-		if resp.DoneEdit != nil && *resp.DoneEdit {
-			// Strip leading newline if requested
-			if currentSuggestion != nil && currentSuggestion.ShouldRemoveLeadingEol && len(currentSuggestion.Text) > 0 {
-				if currentSuggestion.Text[0] == '\n' {
-					currentSuggestion.Text = currentSuggestion.Text[1:]
-					logger.Debug("Stripped leading newline from suggestion")
-				}
-			}
-
-			logger.Debug("Parsed complete suggestion",
-				"chars", len(currentSuggestion.Text),
-				"range", currentSuggestion.Range,
-				"should_remove_leading_eol", currentSuggestion.ShouldRemoveLeadingEol)
-			return currentSuggestion, nil // Complete suggestion ready!
-		}
-
-		if resp.DoneStream != nil && *resp.DoneStream {
-			logger.Debug("Stream ended")
-			return nil, nil // Stream ended, no more suggestions
-		}
-	}
-
-	// Handle stream errors
-	if err := stream.Err(); err != nil && err != io.EOF {
-		return nil, fmt.Errorf("stream error: %w", err)
-	}
-
-	return currentSuggestion, nil
-}
-
 // storeRemainingSuggestions processes remaining suggestions in the stream and stores them in the cache.
 // This runs in a background goroutine after the first suggestion has been returned to the client.
-func storeRemainingSuggestions(ctx context.Context, stream *connect.ServerStreamForClient[aiserverv1.StreamCppResponse], firstNextID string) {
+func (s *server) storeRemainingSuggestions(ctx context.Context, parser *completion.Parser, firstNextID string) {
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Error("Background storage panic", "panic", r)
@@ -357,7 +243,7 @@ func storeRemainingSuggestions(ctx context.Context, stream *connect.ServerStream
 		}
 
 		// Parse next suggestion
-		suggestion, err := parseNextSuggestion(stream)
+		suggestion, err := parser.Next()
 		if err != nil {
 			logger.Error("Error parsing background suggestion",
 				"error", err,
@@ -372,23 +258,19 @@ func storeRemainingSuggestions(ctx context.Context, stream *connect.ServerStream
 			return
 		}
 
-		// Peek at next chunk to see if there are more suggestions
+		// Look ahead to see if there are more suggestions
 		var nextSuggestionID string
-		if stream.Receive() {
-			resp := stream.Msg()
-
-			if resp.BeginEdit != nil && *resp.BeginEdit {
-				// There's another suggestion coming
-				nextSuggestionID = generateSuggestionID()
-			} else if resp.DoneStream != nil && *resp.DoneStream {
-				// Stream is done, no more suggestions
-				nextSuggestionID = ""
-			}
+		more, err := parser.More()
+		if err != nil {
+			logger.Warn("Stream failed after background suggestion", "error", err)
+		}
+		if more {
+			nextSuggestionID = generateSuggestionID()
 		}
 
 		// Store this suggestion with the next ID (or empty if last)
 		suggestion.NextSuggestionID = nextSuggestionID
-		store.Store(currentID, suggestion)
+		s.store.Store(currentID, suggestion)
 		count++
 
 		// Log the addition
@@ -406,20 +288,20 @@ func storeRemainingSuggestions(ctx context.Context, stream *connect.ServerStream
 		logger.Info("Stored background suggestion", logAttrs...)
 
 		// Log ALL suggestions currently in store
-		allSuggestions := store.GetAll()
+		allSuggestions := s.store.GetAll()
 		logger.Debug("All suggestions in store after addition",
 			"total_suggestions_in_store", len(allSuggestions))
-		for id, s := range allSuggestions {
+		for id, stored := range allSuggestions {
 			storeLogAttrs := []any{
 				"id", id,
-				"chars", len(s.Text),
-				"text", s.Text,
-				"next_id", s.NextSuggestionID,
+				"chars", len(stored.Text),
+				"text", stored.Text,
+				"next_id", stored.NextSuggestionID,
 			}
-			if s.Range != nil {
+			if stored.Range != nil {
 				storeLogAttrs = append(storeLogAttrs,
-					"range_start_line", s.Range.StartLine,
-					"range_end_line", s.Range.EndLine)
+					"range_start_line", stored.Range.StartLine,
+					"range_end_line", stored.Range.EndLine)
 			}
 			logger.Debug("  -> Suggestion in store", storeLogAttrs...)
 		}
@@ -436,7 +318,7 @@ func storeRemainingSuggestions(ctx context.Context, stream *connect.ServerStream
 	}
 }
 
-func handleGetSuggestion(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleGetSuggestion(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -449,14 +331,14 @@ func handleGetSuggestion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	storeKeysBeforeGet := store.Keys()
+	storeKeysBeforeGet := s.store.Keys()
 	logger.Info("Get suggestion request", "suggestion_id", suggestionID)
 	logger.Debug("Store state before get",
 		"total_suggestions_in_store", len(storeKeysBeforeGet),
 		"store_keys", storeKeysBeforeGet)
 
 	// Get suggestion from store
-	suggestion := store.Get(suggestionID)
+	suggestion := s.store.Get(suggestionID)
 	if suggestion == nil {
 		logger.Warn("Suggestion not found in store", "suggestion_id", suggestionID)
 		json.NewEncoder(w).Encode(SuggestionResponse{Error: "suggestion not found"})
@@ -472,9 +354,9 @@ func handleGetSuggestion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete this suggestion from store (already retrieved)
-	store.Delete(suggestionID)
+	s.store.Delete(suggestionID)
 
-	storeKeysAfterDelete := store.Keys()
+	storeKeysAfterDelete := s.store.Keys()
 	retrievalLogAttrs := []any{
 		"suggestion_id", suggestionID,
 		"chars", len(suggestion.Text),
@@ -495,9 +377,54 @@ func handleGetSuggestion(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// logCursorInstallation records which Cursor install the credentials and version are read from.
+// It returns the state database path to watch, which may not exist yet, or "" if there
+// is nowhere to look.
+func logCursorInstallation() string {
+	var dbPath string
+	if db, err := cursor.FindStateDB(); err != nil {
+		logger.Warn("Cursor state database not found", "error", err)
+		if expected, ok := cursor.ExpectedStateDB(); ok {
+			logger.Info("Watching for Cursor state database to be created", "path", expected.Path, "source", expected.Source)
+			dbPath = expected.Path
+		}
+	} else {
+		logger.Info("Using Cursor state database", "path", db.Path, "source", db.Source)
+		dbPath = db.Path
+	}
+
+	if pkg, err := cursor.FindPackageJSON(); err != nil {
+		logger.Warn("Cursor package.json not found, using default client version", "error", err)
+	} else {
+		logger.Info("Using Cursor package.json", "path", pkg.Path, "source", pkg.Source)
+	}
+
+	return dbPath
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "shadow-summary" {
+		os.Exit(runShadowSummary(os.Args[2:]))
+	}
+
 	// Parse command-line flags
 	port := flag.Int("port", 0, "Port to listen on (0 = OS assigns available port)")
+	configPath := flag.String("config", "", "Path to JSON config file (default $XDG_CONFIG_HOME/cursor-tab/config.json)")
+	credentialSources := flag.String("credential-sources", "", "Comma-separated credential sources to try in order (env, token-file, config, vscdb)")
+	tokenFile := flag.String("token-file", "", "File containing a Cursor access token")
+	baseURL := flag.String("base-url", "", "Cursor API base URL (env CURSOR_TAB_BASE_URL, default "+cursor.APIBaseURL+")")
+	fallbackURLs := flag.String("fallback-urls", "", "Comma-separated fallback API base URLs (env CURSOR_TAB_FALLBACK_URLS)")
+	watchInterval := flag.Duration("watch-interval", cursor.DefaultWatchInterval, "How often to check state.vscdb for re-authentication")
+	authEndpoint := flag.String("auth-endpoint", "", "OAuth endpoint used to refresh the Cursor access token")
+	proxyURL := flag.String("proxy", "", "Proxy URL for Cursor API requests (default from HTTPS_PROXY)")
+	caFile := flag.String("ca-file", "", "Additional PEM CA bundle to trust, e.g. for a TLS-intercepting proxy")
+	backend := flag.String("backend", "", "Completion backend: cursor or fim (default cursor); a comma-separated list races them")
+	recordDir := flag.String("record-dir", "", "Write every Cursor API call to a fixture file in this directory")
+	replayDir := flag.String("replay-dir", "", "Answer Cursor API calls from the fixtures in this directory instead of the network")
+	fakeUpstream := flag.String("fake-upstream", "", `Replace the Cursor API with "generate" (canned edit chains) or a directory of scripted fixtures`)
+	shadowBackend := flag.String("shadow", "", "Backend to run in shadow mode against the primary, logging both answers")
+	indexWorkspace := flag.Bool("index", true, "Index the workspace locally to attach related code to requests")
+	filesync := flag.Bool("filesync", false, "Send synced documents to the Cursor API as edits instead of full contents (experimental, unverified against the real API; failed requests are resent in full)")
 	flag.Parse()
 
 	// Set up structured logging
@@ -513,16 +440,110 @@ func main() {
 		Level: slog.LevelDebug, // Include debug logs
 	}))
 
-	cursorClient, err = cursor.NewClient()
+	cfg, err := loadConfig(*configPath)
 	if err != nil {
-		logger.Error("Failed to initialize Cursor client", "error", err)
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	sources := cfg.Credentials.Sources
+	if *credentialSources != "" {
+		sources = strings.Split(*credentialSources, ",")
+	}
+	if *tokenFile == "" {
+		*tokenFile = cfg.Credentials.TokenFile
+	}
+	credentials, err := buildCredentialChain(sources, *tokenFile, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid credential sources: %v\n", err)
+		os.Exit(1)
+	}
+
+	stateDBPath := logCursorInstallation()
+
+	if *authEndpoint == "" {
+		*authEndpoint = cfg.Auth.Endpoint
+	}
+
+	upstreamURL, upstreamFallbacks := resolveUpstream(cfg, *baseURL, *fallbackURLs)
+
+	var upstreamHandler aiserverv1connect.AiServiceHandler
+	if *fakeUpstream != "" {
+		upstreamHandler, err = fakeupstream.New(*fakeUpstream)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid fake upstream: %v\n", err)
+			os.Exit(1)
+		}
+		logger.Info("Using fake upstream instead of the Cursor API", "fake_upstream", *fakeUpstream)
+	}
+
+	cursorManager = cursor.NewManager(cursor.Options{
+		Credentials:  credentials,
+		BaseURL:      upstreamURL,
+		FallbackURLs: upstreamFallbacks,
+		Retry: cursor.RetryPolicy{
+			MaxAttempts:    cfg.Retry.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Retry.InitialBackoffMs) * time.Millisecond,
+			MaxBackoff:     time.Duration(cfg.Retry.MaxBackoffMs) * time.Millisecond,
+		},
+		Breaker: cursor.BreakerOptions{
+			FailureThreshold: cfg.Breaker.FailureThreshold,
+			OpenFor:          time.Duration(cfg.Breaker.OpenSeconds) * time.Second,
+		},
+		Transport:    resolveTransport(cfg, *proxyURL, *caFile),
+		RecordDir:    firstNonEmpty(*recordDir, cfg.Upstream.RecordDir),
+		ReplayDir:    firstNonEmpty(*replayDir, cfg.Upstream.ReplayDir),
+		Handler:      upstreamHandler,
+		Filesync:     *filesync || cfg.Upstream.Filesync,
+		AuthEndpoint: *authEndpoint,
+		AuthClientID: cfg.Auth.ClientID,
+		Logger:       logger,
+	}, func(client *cursor.Client) {
+		go client.KeepWarm(context.Background())
+		if stateDBPath != "" {
+			go client.WatchCredentials(context.Background(), stateDBPath, *watchInterval)
+		}
+	})
+
+	backends := resolveBackends(cfg, *backend)
+	completer, err := buildCompleter(backends, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid backend: %v\n", err)
+		os.Exit(1)
+	}
+	if *shadowBackend == "" {
+		*shadowBackend = cfg.Shadow.Backend
+	}
+	if *shadowBackend != "" {
+		completer, err = withShadow(completer, *shadowBackend, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid shadow backend: %v\n", err)
+			os.Exit(1)
+		}
+		backends = append(backends, *shadowBackend)
+	}
+	logger.Info("Using completion backend", "backend", completer.Name(), "shadow", *shadowBackend)
+	if usesCursor(backends) {
+		go cursorManager.Start(context.Background())
 	}
 
-	// POST /suggestion/new - generate new suggestions from Cursor
-	http.HandleFunc("/suggestion/new", handleNewSuggestion)
+	srv := newServer(completer, cursorManager)
+	if cfg.Context.AdditionalFilesBytes != 0 {
+		srv.additionalFilesBudget = cfg.Context.AdditionalFilesBytes
+	}
+	if cfg.Context.MaxAdditionalFiles > 0 {
+		srv.maxAdditionalFiles = cfg.Context.MaxAdditionalFiles
+	}
 
-	// GET /suggestion/{id} - retrieve existing suggestion from store
-	http.HandleFunc("/suggestion/", handleGetSuggestion)
+	if *indexWorkspace && !cfg.Index.Disabled {
+		srv.workspaceIndex = index.NewManager(index.Options{
+			MaxFiles:       cfg.Index.MaxFiles,
+			TopChunks:      cfg.Index.TopChunks,
+			RescanInterval: time.Duration(cfg.Index.RescanSeconds) * time.Second,
+			Logger:         logger,
+		})
+		defer srv.workspaceIndex.Close()
+	}
 
 	// Create listener to get actual port
 	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", *port))
@@ -542,13 +563,10 @@ func main() {
 
 	logger.Info("Server starting",
 		"address", fmt.Sprintf("localhost:%d", serverPort),
-		"endpoints", []string{
-			"POST /suggestion/new",
-			"GET /suggestion/{id}",
-		},
+		"endpoints", srv.endpointNames(),
 	)
 
-	if err := http.Serve(listener, nil); err != nil {
+	if err := http.Serve(listener, srv.routes()); err != nil {
 		logger.Error("Server error", "error", err)
 		os.Exit(1)
 	}
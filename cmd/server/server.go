@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/buffers"
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+	"github.com/bengu3/cursor-tab.nvim/internal/diffhistory"
+	"github.com/bengu3/cursor-tab.nvim/internal/document"
+	"github.com/bengu3/cursor-tab.nvim/internal/index"
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+// server holds everything the HTTP handlers share.
+type server struct {
+	completer completion.Completer
+	// cursorManager is reported on by /status.
+	cursorManager *cursor.Manager
+
+	store       *suggestionstore.Store
+	edits       *diffhistory.Tracker
+	documents   *document.Store
+	openBuffers *buffers.Tracker
+	// workspaceIndex is nil when indexing is disabled.
+	workspaceIndex *index.Manager
+
+	// Limits on the other files attached to a request, from the context config section.
+	additionalFilesBudget int
+	maxAdditionalFiles    int
+}
+
+// newServer returns a server with empty stores and no workspace index.
+func newServer(completer completion.Completer, cursorManager *cursor.Manager) *server {
+	return &server{
+		completer:             completer,
+		cursorManager:         cursorManager,
+		store:                 suggestionstore.NewStore(),
+		edits:                 diffhistory.New(diffhistory.Options{}),
+		documents:             document.NewStore(),
+		openBuffers:           buffers.NewTracker(),
+		additionalFilesBudget: buffers.DefaultBudgetBytes,
+		maxAdditionalFiles:    buffers.DefaultMaxFiles,
+	}
+}
+
+// endpoint is one route of the HTTP API. Name is how it is logged, e.g.
+// "GET /suggestion/{id}" for the pattern "/suggestion/".
+type endpoint struct {
+	name    string
+	pattern string
+	handler http.HandlerFunc
+}
+
+func (s *server) endpoints() []endpoint {
+	return []endpoint{
+		// Generate new suggestions from Cursor
+		{"POST /suggestion/new", "/suggestion/new", s.handleNewSuggestion},
+		// Retrieve an existing suggestion from the store
+		{"GET /suggestion/{id}", "/suggestion/", s.handleGetSuggestion},
+		// Incremental buffer sync
+		{"POST /document/open", "/document/open", s.handleOpenDocument},
+		{"POST /document/change", "/document/change", s.handleChangeDocument},
+		{"POST /document/close", "/document/close", s.handleCloseDocument},
+		// Open buffers and their visible ranges
+		{"POST /workspace/buffers", "/workspace/buffers", s.handleBuffers},
+		// Credential and upstream health
+		{"GET /status", "/status", s.handleStatus},
+	}
+}
+
+// endpointNames lists the endpoints for the startup log.
+func (s *server) endpointNames() []string {
+	var names []string
+	for _, e := range s.endpoints() {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// routes returns the handler for every endpoint.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	for _, e := range s.endpoints() {
+		mux.HandleFunc(e.pattern, e.handler)
+	}
+	return mux
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/config"
+	"github.com/bengu3/cursor-tab.nvim/internal/shadow"
+)
+
+// withShadow wraps primary so every request is also sent to the named backend in the background
+func withShadow(primary completion.Completer, name string, cfg *config.Config) (completion.Completer, error) {
+	secondary, err := newCompleter(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if secondary.Name() == primary.Name() {
+		return nil, fmt.Errorf("shadow backend %q is the primary backend", name)
+	}
+
+	path := firstNonEmpty(cfg.Shadow.LogFile, shadow.DefaultLogFile)
+	recorder, err := shadow.OpenRecorder(path)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Shadow mode enabled", "secondary", secondary.Name(), "log_file", path)
+
+	timeout := time.Duration(cfg.Shadow.TimeoutMs) * time.Millisecond
+	return shadow.New(primary, secondary, recorder, timeout, logger), nil
+}
+
+// runShadowSummary implements the shadow-summary subcommand
+func runShadowSummary(args []string) int {
+	flags := flag.NewFlagSet("shadow-summary", flag.ExitOnError)
+	path := flags.String("file", shadow.DefaultLogFile, "Shadow log to summarize")
+	flags.Parse(args)
+
+	file, err := os.Open(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open shadow log: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	summary, err := shadow.Summarize(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	summary.Print(os.Stdout)
+	return 0
+}
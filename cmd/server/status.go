@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+	"github.com/bengu3/cursor-tab.nvim/internal/shadow"
+)
+
+type StatusResponse struct {
+	Backend     string                    `json:"backend"`
+	Race        []completion.BackendStats `json:"race,omitempty"`
+	Initialized bool                      `json:"initialized"`
+	InitError   string                    `json:"init_error,omitempty"`
+	Client      cursor.ManagerStatus      `json:"client"`
+	Cursor      *cursor.Status            `json:"cursor,omitempty"`
+}
+
+// handleStatus reports why completions may not be working: credentials, token expiry and the last upstream error
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	managerStatus := s.cursorManager.Status()
+	response := StatusResponse{
+		Backend:     s.completer.Name(),
+		Initialized: managerStatus.State == cursor.ManagerReady,
+		InitError:   managerStatus.LastError,
+		Client:      managerStatus,
+	}
+	served := s.completer
+	if shadowed, ok := served.(*shadow.Completer); ok {
+		served = shadowed.Primary()
+	}
+	if race, ok := served.(*completion.Race); ok {
+		response.Race = race.Stats()
+	}
+	if response.Initialized {
+		client, _ := s.cursorManager.Client()
+		status := client.Status()
+		response.Cursor = &status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor/cursortest"
+)
+
+func TestMain(m *testing.M) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// newTestServer serves the HTTP API on top of a Cursor client talking to upstream.
+func newTestServer(t *testing.T, upstream *cursortest.Server) *httptest.Server {
+	t.Helper()
+	client := upstream.Client(t, cursor.Options{Retry: cursor.RetryPolicy{MaxAttempts: 1}})
+	httpServer := httptest.NewServer(newServer(client, nil).routes())
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func postSuggestion(t *testing.T, baseURL string, req NewSuggestionRequest) SuggestionResponse {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(baseURL+"/suggestion/new", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /suggestion/new: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out SuggestionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decoding /suggestion/new response: %v", err)
+	}
+	return out
+}
+
+func fetchSuggestion(t *testing.T, baseURL, id string) SuggestionResponse {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/suggestion/" + id)
+	if err != nil {
+		t.Fatalf("GET /suggestion/%s: %v", id, err)
+	}
+	defer resp.Body.Close()
+
+	var out SuggestionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decoding /suggestion/%s response: %v", id, err)
+	}
+	return out
+}
+
+// getSuggestion fetches a chained suggestion, waiting for the background reader to
+// store it.
+func getSuggestion(t *testing.T, baseURL, id string) SuggestionResponse {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		out := fetchSuggestion(t, baseURL, id)
+		if out.Error != "suggestion not found" || time.Now().After(deadline) {
+			return out
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var testRequest = NewSuggestionRequest{
+	FileContents:  "package main\n\nfunc main() {\n}\n",
+	Line:          2,
+	Column:        13,
+	FilePath:      "main.go",
+	LanguageID:    "go",
+	WorkspacePath: "/work",
+}
+
+func TestNewSuggestionSingleEdit(t *testing.T) {
+	upstream := cursortest.NewServer(t, cursortest.Script(
+		cursortest.Edit(3, 4, "func main() {\n\tfmt.Println(\"hi\")\n}"),
+		cursortest.DoneStream(),
+	))
+	srv := newTestServer(t, upstream)
+
+	got := postSuggestion(t, srv.URL, testRequest)
+	if got.Error != "" {
+		t.Fatalf("error = %q", got.Error)
+	}
+	if want := "func main() {\n\tfmt.Println(\"hi\")\n}"; got.Suggestion != want {
+		t.Errorf("suggestion = %q, want %q", got.Suggestion, want)
+	}
+	if got.RangeReplace == nil || got.RangeReplace.StartLine != 3 || got.RangeReplace.EndLine != 4 {
+		t.Errorf("range = %+v, want lines 3-4", got.RangeReplace)
+	}
+	if got.NextSuggestionID != "" {
+		t.Errorf("next_suggestion_id = %q, want none", got.NextSuggestionID)
+	}
+
+	calls := upstream.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("upstream calls = %d, want 1", len(calls))
+	}
+	if contents := calls[0].Request.GetCurrentFile().GetContents(); contents != testRequest.FileContents {
+		t.Errorf("upstream file contents = %q, want %q", contents, testRequest.FileContents)
+	}
+}
+
+func TestNewSuggestionChain(t *testing.T) {
+	upstream := cursortest.NewServer(t, cursortest.Script(
+		cursortest.Edit(3, 3, "first"),
+		cursortest.BeginEdit(),
+		// The rest is read after /suggestion/new has returned.
+		cursortest.Range(5, 6),
+		cursortest.Delay(50*time.Millisecond),
+		cursortest.Text("sec"),
+		cursortest.Text("ond"),
+		cursortest.DoneEdit(),
+		cursortest.BeginEdit(),
+		cursortest.Edit(8, 8, "third"),
+		cursortest.DoneStream(),
+	))
+	srv := newTestServer(t, upstream)
+
+	first := postSuggestion(t, srv.URL, testRequest)
+	if first.Error != "" {
+		t.Fatalf("error = %q", first.Error)
+	}
+	if first.Suggestion != "first" || first.NextSuggestionID == "" {
+		t.Fatalf("first = %+v, want %q with a next suggestion", first, "first")
+	}
+
+	second := getSuggestion(t, srv.URL, first.NextSuggestionID)
+	if second.Error != "" {
+		t.Fatalf("second: error = %q", second.Error)
+	}
+	if second.Suggestion != "second" || second.RangeReplace == nil || second.RangeReplace.StartLine != 5 {
+		t.Errorf("second = %+v, want %q at line 5", second, "second")
+	}
+	if second.NextSuggestionID == "" {
+		t.Fatalf("second has no next suggestion")
+	}
+
+	third := getSuggestion(t, srv.URL, second.NextSuggestionID)
+	if third.Suggestion != "third" || third.NextSuggestionID != "" {
+		t.Errorf("third = %+v, want %q ending the chain", third, "third")
+	}
+
+	// A suggestion is handed out once.
+	if again := fetchSuggestion(t, srv.URL, first.NextSuggestionID); again.Error != "suggestion not found" {
+		t.Errorf("second fetch of %s = %+v, want not found", first.NextSuggestionID, again)
+	}
+}
+
+func TestNewSuggestionUpstreamError(t *testing.T) {
+	upstream := cursortest.NewServer(t, cursortest.Script(
+		cursortest.Error(connect.CodeInvalidArgument, "bad request"),
+	))
+	srv := newTestServer(t, upstream)
+
+	got := postSuggestion(t, srv.URL, testRequest)
+	if got.Error == "" || got.Suggestion != "" {
+		t.Errorf("response = %+v, want an error", got)
+	}
+}
@@ -5,5 +5,8 @@ go 1.21
 require (
 	connectrpc.com/connect v1.17.0
 	github.com/google/uuid v1.6.0
+	golang.org/x/net v0.35.0
 	google.golang.org/protobuf v1.35.2
 )
+
+require golang.org/x/text v0.22.0 // indirect
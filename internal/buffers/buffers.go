@@ -0,0 +1,195 @@
+// Package buffers tracks which files the editor has open and which parts of them the
+// user has been looking at, and picks the ones worth sending along with a request.
+package buffers
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBudgetBytes bounds the visible content attached to one request.
+	DefaultBudgetBytes = 24000
+	// DefaultMaxFiles bounds how many other files are attached to one request.
+	DefaultMaxFiles = 8
+	// maxTracked is how many files are remembered per workspace.
+	maxTracked = 50
+)
+
+// Range is a 1-indexed, inclusive span of lines. Lines holds their text when the
+// editor sends it; otherwise it is read from the synced document.
+type Range struct {
+	StartLine int32    `json:"start_line"`
+	EndLine   int32    `json:"end_line"`
+	Lines     []string `json:"lines,omitempty"`
+}
+
+// Buffer is an open file as reported by the editor, with the ranges shown in windows.
+// A buffer with no visible ranges is open but hidden.
+type Buffer struct {
+	FilePath      string  `json:"file_path"`
+	VisibleRanges []Range `json:"visible_ranges,omitempty"`
+}
+
+// File is another file to give the model as context.
+type File struct {
+	Path       string
+	IsOpen     bool
+	LastViewed time.Time
+	// Ranges are what the user last saw of the file, with Lines filled in.
+	Ranges []Range
+}
+
+// ContentsFunc returns the current contents of a file, if known.
+type ContentsFunc func(path string) (string, bool)
+
+type entry struct {
+	open       bool
+	lastViewed time.Time
+	ranges     []Range
+}
+
+// Tracker remembers the open and recently viewed files of each workspace. It is safe
+// for concurrent use.
+type Tracker struct {
+	mu         sync.Mutex
+	workspaces map[string]map[string]*entry
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{workspaces: make(map[string]map[string]*entry)}
+}
+
+// Report replaces the set of open buffers in workspace. Visible buffers count as
+// viewed at time at; files no longer open are remembered as recently viewed.
+func (t *Tracker) Report(workspace string, buffers []Buffer, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	files := t.workspaces[workspace]
+	if files == nil {
+		files = make(map[string]*entry)
+		t.workspaces[workspace] = files
+	}
+	for _, e := range files {
+		e.open = false
+	}
+
+	for _, buffer := range buffers {
+		e := files[buffer.FilePath]
+		if e == nil {
+			e = &entry{}
+			files[buffer.FilePath] = e
+		}
+		e.open = true
+		if ranges := validRanges(buffer.VisibleRanges); len(ranges) > 0 {
+			e.ranges = ranges
+			e.lastViewed = at
+		}
+	}
+
+	for len(files) > maxTracked {
+		var evict string
+		first := true
+		for path, e := range files {
+			if first || evictsBefore(e, files[evict]) {
+				evict, first = path, false
+			}
+		}
+		delete(files, evict)
+	}
+}
+
+// evictsBefore reports whether a should be forgotten before b: closed files go first,
+// then the least recently viewed.
+func evictsBefore(a, b *entry) bool {
+	if a.open != b.open {
+		return !a.open
+	}
+	return a.lastViewed.Before(b.lastViewed)
+}
+
+func validRanges(ranges []Range) []Range {
+	var valid []Range
+	for _, r := range ranges {
+		if r.StartLine < 1 || r.EndLine < r.StartLine {
+			continue
+		}
+		valid = append(valid, r)
+	}
+	return valid
+}
+
+// Select returns the files of workspace other than exclude that were viewed, most
+// recently viewed first, with their ranges filled from contents or the lines the
+// editor sent. It stops at maxFiles files or budget bytes of content, trimming the
+// last file's ranges to fit.
+func (t *Tracker) Select(workspace, exclude string, contents ContentsFunc, maxFiles, budget int) []File {
+	t.mu.Lock()
+	var candidates []File
+	for path, e := range t.workspaces[workspace] {
+		if path == exclude || e.lastViewed.IsZero() {
+			continue
+		}
+		candidates = append(candidates, File{Path: path, IsOpen: e.open, LastViewed: e.lastViewed, Ranges: e.ranges})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].LastViewed.After(candidates[j].LastViewed)
+	})
+
+	var selected []File
+	for _, file := range candidates {
+		if len(selected) >= maxFiles || budget <= 0 {
+			break
+		}
+		var lines []string
+		if text, ok := contents(file.Path); ok {
+			lines = strings.Split(text, "\n")
+		}
+
+		var ranges []Range
+		for _, r := range file.Ranges {
+			filled, size := fill(r, lines, budget)
+			if len(filled.Lines) == 0 {
+				continue
+			}
+			ranges = append(ranges, filled)
+			budget -= size
+		}
+		if len(ranges) > 0 {
+			file.Ranges = ranges
+			selected = append(selected, file)
+		}
+	}
+	return selected
+}
+
+// fill returns r with the lines it covers, from lines if known, cut short to fit in
+// budget bytes, and the size of those lines.
+func fill(r Range, lines []string, budget int) (Range, int) {
+	source := r.Lines
+	if lines != nil {
+		start := int(r.StartLine) - 1
+		end := min(int(r.EndLine), len(lines))
+		source = nil
+		if start < end {
+			source = lines[start:end]
+		}
+	}
+
+	filled := Range{StartLine: r.StartLine}
+	size := 0
+	for _, line := range source {
+		if size+len(line)+1 > budget {
+			break
+		}
+		filled.Lines = append(filled.Lines, line)
+		size += len(line) + 1
+	}
+	filled.EndLine = r.StartLine + int32(len(filled.Lines)) - 1
+	return filled, size
+}
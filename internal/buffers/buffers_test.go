@@ -0,0 +1,68 @@
+package buffers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func visible(path string) Buffer {
+	return Buffer{FilePath: path, VisibleRanges: []Range{{StartLine: 1, EndLine: 1, Lines: []string{path}}}}
+}
+
+func TestReportEvictsClosedFilesFirst(t *testing.T) {
+	tracker := NewTracker()
+	t0 := time.Unix(1000, 0)
+	noContents := func(string) (string, bool) { return "", false }
+
+	// open.go stays open but hidden from here on, so it is the least recently viewed.
+	tracker.Report("/work", []Buffer{visible("open.go")}, t0)
+
+	buffers := []Buffer{{FilePath: "open.go"}}
+	for i := 0; i < maxTracked-1; i++ {
+		buffers = append(buffers, visible(fmt.Sprintf("closed%d.go", i)))
+	}
+	tracker.Report("/work", buffers, t0.Add(time.Minute))
+
+	// The closed files are now closed, and one of them has to go.
+	tracker.Report("/work", []Buffer{{FilePath: "open.go"}, visible("new.go")}, t0.Add(2*time.Minute))
+
+	files := tracker.Select("/work", "", noContents, maxTracked+1, 1<<20)
+	if len(files) != maxTracked {
+		t.Fatalf("tracked %d files, want %d", len(files), maxTracked)
+	}
+	var open, closed int
+	for _, file := range files {
+		if file.IsOpen {
+			open++
+		} else {
+			closed++
+		}
+	}
+	if open != 2 || closed != maxTracked-2 {
+		t.Errorf("kept %d open and %d closed files, want 2 and %d", open, closed, maxTracked-2)
+	}
+	if last := files[len(files)-1]; last.Path != "open.go" {
+		t.Errorf("least recently viewed = %s, want open.go", last.Path)
+	}
+}
+
+func TestReportEvictsLeastRecentlyViewed(t *testing.T) {
+	tracker := NewTracker()
+	t0 := time.Unix(1000, 0)
+	noContents := func(string) (string, bool) { return "", false }
+
+	for i := 0; i <= maxTracked; i++ {
+		tracker.Report("/work", []Buffer{visible(fmt.Sprintf("f%d.go", i))}, t0.Add(time.Duration(i)*time.Second))
+	}
+
+	files := tracker.Select("/work", "", noContents, maxTracked+1, 1<<20)
+	if len(files) != maxTracked {
+		t.Fatalf("tracked %d files, want %d", len(files), maxTracked)
+	}
+	for _, file := range files {
+		if file.Path == "f0.go" {
+			t.Errorf("f0.go, the least recently viewed, was kept")
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package completion defines the provider-neutral interface between the HTTP server
+// and the backends that produce tab completions.
+package completion
+
+import (
+	"context"
+	"time"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+// Request is everything a backend gets to know about the editor state.
+type Request struct {
+	// FilePath is absolute, as the editor sends it, and normally inside the
+	// WorkspacePath directory. Backends that need a workspace-relative path make it
+	// themselves. The paths of the files and chunks below are absolute too.
+	FilePath      string
+	WorkspacePath string
+	LanguageID    string
+	FileContents  string
+	// Line and Column are the 0-indexed cursor position.
+	Line   int32
+	Column int32
+	// RecentEdits are the files in the workspace edited lately, least recent first.
+	RecentEdits []FileEdits
+	// Document is the synced document FileContents was taken from, if the editor uses
+	// document sync. Backends may use it to send only what changed.
+	Document *Document
+	// Diagnostics are the editor's diagnostics for the file, normalized with
+	// NormalizeDiagnostics.
+	Diagnostics []Diagnostic
+	// AdditionalFiles are other files the user has open or recently viewed, most
+	// recently viewed first.
+	AdditionalFiles []AdditionalFile
+	// RelatedChunks are workspace code chunks that match the text around the cursor,
+	// best first.
+	RelatedChunks []Chunk
+}
+
+// FileEdits is the recent edit history of one file.
+type FileEdits struct {
+	Path string
+	// Diffs are unified diffs, oldest first.
+	Diffs []Diff
+	// Merged is a single diff from before the oldest of Diffs to the current contents.
+	Merged string
+}
+
+type Diff struct {
+	Text string
+	At   time.Time
+}
+
+// Document is a synced document at one version.
+type Document struct {
+	Workspace string
+	Path      string
+	Version   int32
+	Contents  string
+	// Changes are the most recent changes, oldest first, ending at Version.
+	Changes []DocumentChange
+	// ChangesFrom is the version Changes start from.
+	ChangesFrom int32
+}
+
+// DocumentChange is one edit to a Document, resolved against the text it was
+// applied to.
+type DocumentChange struct {
+	// Version is the document version the change produced.
+	Version int32
+	// Start and End are byte offsets into the previous text, at StartPos and EndPos.
+	Start, End       int
+	StartPos, EndPos Position
+	Text             string
+	// Length is the length of the document after the change.
+	Length int
+	// UTF16 has the same offsets counted in UTF-16 code units, as VS Code counts them.
+	UTF16 UTF16Offsets
+}
+
+// UTF16Offsets are the offsets of a DocumentChange in UTF-16 code units. Lines are the
+// same as in StartPos and EndPos.
+type UTF16Offsets struct {
+	Start, End             int
+	StartColumn, EndColumn int
+	Length                 int
+}
+
+// ChangesSince returns the changes that turn version into d.Version, or false if they
+// are no longer known.
+func (d *Document) ChangesSince(version int32) ([]DocumentChange, bool) {
+	if version < d.ChangesFrom || version > d.Version {
+		return nil, false
+	}
+	for i, change := range d.Changes {
+		if change.Version > version {
+			return d.Changes[i:], true
+		}
+	}
+	return nil, true
+}
+
+// AdditionalFile is another file the user has open or recently viewed.
+type AdditionalFile struct {
+	Path       string
+	IsOpen     bool
+	LastViewed time.Time
+	// Ranges are what the user last saw of the file.
+	Ranges []VisibleRange
+}
+
+// VisibleRange is a span of 1-indexed, inclusive lines and their text.
+type VisibleRange struct {
+	StartLine int32
+	EndLine   int32
+	Lines     []string
+}
+
+// Chunk is a piece of workspace code related to the text around the cursor.
+type Chunk struct {
+	Path      string
+	StartLine int // 1-indexed
+	EndLine   int // inclusive
+	Content   string
+	Score     float64
+}
+
+type EventKind int
+
+const (
+	// EventBeginEdit starts another edit after the first one.
+	EventBeginEdit EventKind = iota + 1
+	// EventRange sets the lines the current edit replaces.
+	EventRange
+	// EventText appends to the current edit's text.
+	EventText
+	// EventDoneEdit ends the current edit.
+	EventDoneEdit
+	// EventDoneStream ends the stream; no more edits follow.
+	EventDoneStream
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventBeginEdit:
+		return "begin_edit"
+	case EventRange:
+		return "range"
+	case EventText:
+		return "text"
+	case EventDoneEdit:
+		return "done_edit"
+	case EventDoneStream:
+		return "done_stream"
+	}
+	return "unknown"
+}
+
+// Event is one step of a completion stream. A stream is a sequence of edits, each
+// made of an optional range, text, and a DoneEdit, and ends with DoneStream.
+type Event struct {
+	Kind EventKind
+	// Text is set for EventText.
+	Text string
+	// Range, BindingID and ShouldRemoveLeadingEol are set for EventRange. Range lines
+	// are 1-indexed and inclusive.
+	Range                  *suggestionstore.RangeInfo
+	BindingID              string
+	ShouldRemoveLeadingEol bool
+}
+
+// Stream is a sequence of events from a backend.
+type Stream interface {
+	// Receive advances to the next event, returning false at the end of the stream or on error.
+	Receive() bool
+	// Event returns the event read by the last successful Receive.
+	Event() Event
+	// Err returns the error that ended the stream, if any.
+	Err() error
+	// Close releases the stream. It is safe to call before the stream is drained.
+	Close() error
+}
+
+// Completer is a completion backend.
+type Completer interface {
+	// Name identifies the backend in logs and metrics.
+	Name() string
+	// Complete starts a completion. Failures before any event is available, such as
+	// an unreachable backend, are returned here rather than from the stream.
+	Complete(ctx context.Context, req *Request) (Stream, error)
+}
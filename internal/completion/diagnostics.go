@@ -0,0 +1,153 @@
+package completion
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxDiagnostics bounds how many diagnostics are passed to a backend; errors and
+	// those nearest the cursor are kept.
+	MaxDiagnostics = 50
+	// maxDiagnosticMessage truncates long messages such as template instantiation traces.
+	maxDiagnosticMessage = 2000
+)
+
+// Severities, numbered as in LSP and vim.diagnostic.
+const (
+	SeverityError       = 1
+	SeverityWarning     = 2
+	SeverityInformation = 3
+	SeverityHint        = 4
+)
+
+// Position is a 0-indexed line and byte column.
+type Position struct {
+	Line   int32 `json:"line"`
+	Column int32 `json:"column"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Diagnostic is an editor diagnostic in the current file.
+type Diagnostic struct {
+	Message  string               `json:"message"`
+	Source   string               `json:"source,omitempty"`
+	Severity int                  `json:"severity,omitempty"`
+	Range    Range                `json:"range"`
+	Related  []RelatedInformation `json:"related,omitempty"`
+}
+
+// RelatedInformation points at another location in the file that explains a
+// diagnostic, such as a previous declaration.
+type RelatedInformation struct {
+	Message string `json:"message"`
+	Range   Range  `json:"range"`
+}
+
+// NormalizeDiagnostics drops diagnostics without a message, clamps ranges to
+// contents, resets unknown severities and keeps at most MaxDiagnostics, preferring
+// errors and those nearest cursorLine.
+func NormalizeDiagnostics(diagnostics []Diagnostic, contents string, cursorLine int32) []Diagnostic {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	lineLengths := lineLengths(contents)
+
+	var normalized []Diagnostic
+	for _, d := range diagnostics {
+		if strings.TrimSpace(d.Message) == "" {
+			continue
+		}
+		d.Message = truncate(d.Message, maxDiagnosticMessage)
+		if d.Severity < SeverityError || d.Severity > SeverityHint {
+			d.Severity = 0
+		}
+		d.Range = clampRange(d.Range, lineLengths)
+
+		var related []RelatedInformation
+		for _, r := range d.Related {
+			if strings.TrimSpace(r.Message) == "" {
+				continue
+			}
+			related = append(related, RelatedInformation{
+				Message: truncate(r.Message, maxDiagnosticMessage),
+				Range:   clampRange(r.Range, lineLengths),
+			})
+		}
+		d.Related = related
+		normalized = append(normalized, d)
+	}
+
+	if len(normalized) > MaxDiagnostics {
+		sort.SliceStable(normalized, func(i, j int) bool {
+			a, b := normalized[i], normalized[j]
+			if rank(a.Severity) != rank(b.Severity) {
+				return rank(a.Severity) < rank(b.Severity)
+			}
+			return distance(a.Range, cursorLine) < distance(b.Range, cursorLine)
+		})
+		normalized = normalized[:MaxDiagnostics]
+		sort.SliceStable(normalized, func(i, j int) bool {
+			return normalized[i].Range.Start.Line < normalized[j].Range.Start.Line
+		})
+	}
+	return normalized
+}
+
+func lineLengths(contents string) []int32 {
+	lines := strings.Split(contents, "\n")
+	lengths := make([]int32, len(lines))
+	for i, line := range lines {
+		lengths[i] = int32(len(line))
+	}
+	return lengths
+}
+
+func clampRange(r Range, lineLengths []int32) Range {
+	r.Start = clampPosition(r.Start, lineLengths)
+	r.End = clampPosition(r.End, lineLengths)
+	if r.End.Line < r.Start.Line || (r.End.Line == r.Start.Line && r.End.Column < r.Start.Column) {
+		r.Start, r.End = r.End, r.Start
+	}
+	return r
+}
+
+func clampPosition(p Position, lineLengths []int32) Position {
+	last := int32(len(lineLengths) - 1)
+	p.Line = min(max(p.Line, 0), last)
+	p.Column = min(max(p.Column, 0), lineLengths[p.Line])
+	return p
+}
+
+// rank orders severities with unspecified ones after hints.
+func rank(severity int) int {
+	if severity == 0 {
+		return SeverityHint + 1
+	}
+	return severity
+}
+
+func distance(r Range, line int32) int32 {
+	switch {
+	case line < r.Start.Line:
+		return r.Start.Line - line
+	case line > r.End.Line:
+		return line - r.End.Line
+	}
+	return 0
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// Back up to a rune boundary.
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
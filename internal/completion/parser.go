@@ -0,0 +1,179 @@
+package completion
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+type parserState int
+
+const (
+	// stateBetween is before the first edit and after each DoneEdit.
+	stateBetween parserState = iota
+	// stateInEdit is after an edit has started, until its DoneEdit.
+	stateInEdit
+	// stateDone is after DoneStream, the end of the stream, or an error.
+	stateDone
+)
+
+func (s parserState) String() string {
+	switch s {
+	case stateBetween:
+		return "between_edits"
+	case stateInEdit:
+		return "in_edit"
+	case stateDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// Parser turns a stream of events into complete suggestions. It is the only place
+// that interprets events, so the first suggestion and the ones stored in the
+// background are built the same way.
+//
+// An edit starts with BeginEdit, or implicitly with its first Range or Text event,
+// and ends with DoneEdit. A BeginEdit inside an edit ends it as if DoneEdit had come
+// first. An edit cut off by DoneStream or the end of the stream is dropped, since
+// applying half a suggestion would corrupt the buffer.
+type Parser struct {
+	stream  Stream
+	state   parserState
+	current *suggestionstore.Suggestion
+
+	// lookahead holds one event read by More, or by Next when it had to read past
+	// the end of an edit.
+	lookahead *Event
+	err       error
+}
+
+func NewParser(stream Stream) *Parser {
+	return &Parser{stream: stream}
+}
+
+// read returns the next event, from the lookahead if there is one.
+func (p *Parser) read() (Event, bool) {
+	if p.lookahead != nil {
+		event := *p.lookahead
+		p.lookahead = nil
+		return event, true
+	}
+	if p.state == stateDone || !p.stream.Receive() {
+		p.finish()
+		return Event{}, false
+	}
+	return p.stream.Event(), true
+}
+
+func (p *Parser) unread(event Event) {
+	p.lookahead = &event
+}
+
+func (p *Parser) finish() {
+	p.state = stateDone
+	if p.err == nil {
+		if err := p.stream.Err(); err != nil && !errors.Is(err, io.EOF) {
+			p.err = fmt.Errorf("stream error: %w", err)
+		}
+	}
+}
+
+// Next returns the next complete suggestion, or nil once the stream has no more.
+// The error that ended the stream is returned instead of a suggestion that it cut
+// short.
+func (p *Parser) Next() (*suggestionstore.Suggestion, error) {
+	for {
+		event, ok := p.read()
+		if !ok {
+			p.current = nil
+			return nil, p.err
+		}
+
+		switch p.state {
+		case stateBetween:
+			switch event.Kind {
+			case EventBeginEdit:
+				p.begin()
+			case EventRange, EventText:
+				p.begin()
+				p.apply(event)
+			case EventDoneStream:
+				p.state = stateDone
+				return nil, nil
+			}
+			// A DoneEdit with no edit open carries nothing.
+
+		case stateInEdit:
+			switch event.Kind {
+			case EventRange, EventText:
+				p.apply(event)
+			case EventDoneEdit:
+				return p.complete(), nil
+			case EventBeginEdit:
+				p.unread(event)
+				return p.complete(), nil
+			case EventDoneStream:
+				p.current = nil
+				p.state = stateDone
+				return nil, nil
+			}
+		}
+	}
+}
+
+// More reports whether another suggestion follows the last one returned by Next,
+// without consuming it. It does not wait for that suggestion to complete.
+func (p *Parser) More() (bool, error) {
+	for {
+		event, ok := p.read()
+		if !ok {
+			return false, p.err
+		}
+		switch event.Kind {
+		case EventBeginEdit, EventRange, EventText:
+			p.unread(event)
+			return true, nil
+		case EventDoneStream:
+			p.state = stateDone
+			return false, nil
+		}
+		// Skip a stray DoneEdit.
+	}
+}
+
+func (p *Parser) begin() {
+	p.current = &suggestionstore.Suggestion{}
+	p.state = stateInEdit
+}
+
+func (p *Parser) apply(event Event) {
+	switch event.Kind {
+	case EventRange:
+		p.current.Range = event.Range
+		p.current.BindingID = event.BindingID
+		p.current.ShouldRemoveLeadingEol = event.ShouldRemoveLeadingEol
+	case EventText:
+		p.current.Text += event.Text
+	}
+}
+
+// complete ends the current edit, stripping the leading line break the backend asked
+// to have removed.
+func (p *Parser) complete() *suggestionstore.Suggestion {
+	s := p.current
+	p.current = nil
+	p.state = stateBetween
+
+	if s.ShouldRemoveLeadingEol {
+		if rest, ok := strings.CutPrefix(s.Text, "\r\n"); ok {
+			s.Text = rest
+		} else {
+			s.Text = strings.TrimPrefix(s.Text, "\n")
+		}
+	}
+	return s
+}
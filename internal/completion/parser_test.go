@@ -0,0 +1,202 @@
+package completion
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+// replayStream replays a recorded sequence of events, then ends with err.
+type replayStream struct {
+	events []Event
+	next   int
+	err    error
+}
+
+func (s *replayStream) Receive() bool {
+	if s.next >= len(s.events) {
+		return false
+	}
+	s.next++
+	return true
+}
+
+func (s *replayStream) Event() Event { return s.events[s.next-1] }
+func (s *replayStream) Err() error   { return s.err }
+func (s *replayStream) Close() error { return nil }
+
+func begin() Event        { return Event{Kind: EventBeginEdit} }
+func text(t string) Event { return Event{Kind: EventText, Text: t} }
+func doneEdit() Event     { return Event{Kind: EventDoneEdit} }
+func doneStream() Event   { return Event{Kind: EventDoneStream} }
+func lines(start, end int32) Event {
+	return Event{Kind: EventRange, Range: &suggestionstore.RangeInfo{StartLine: start, EndLine: end}, BindingID: "b"}
+}
+
+func suggestion(start, end int32, text string) *suggestionstore.Suggestion {
+	return &suggestionstore.Suggestion{
+		Text:      text,
+		Range:     &suggestionstore.RangeInfo{StartLine: start, EndLine: end},
+		BindingID: "b",
+	}
+}
+
+func TestParser(t *testing.T) {
+	errReset := errors.New("stream reset")
+
+	tests := []struct {
+		name   string
+		events []Event
+		err    error
+		want   []*suggestionstore.Suggestion
+		// wantMore is what More reports after the first suggestion.
+		wantMore bool
+		wantErr  error
+	}{
+		{
+			name:   "single edit",
+			events: []Event{lines(3, 4), text("foo"), text("bar"), doneEdit(), doneStream()},
+			want:   []*suggestionstore.Suggestion{suggestion(3, 4, "foobar")},
+		},
+		{
+			name: "chained edits",
+			events: []Event{
+				lines(1, 1), text("a"), doneEdit(),
+				begin(), lines(5, 6), text("b"), doneEdit(),
+				doneStream(),
+			},
+			want:     []*suggestionstore.Suggestion{suggestion(1, 1, "a"), suggestion(5, 6, "b")},
+			wantMore: true,
+		},
+		{
+			name: "begin edit interleaved before done edit",
+			events: []Event{
+				lines(1, 1), text("a"),
+				begin(), lines(2, 2), text("b"), doneEdit(),
+				doneStream(),
+			},
+			want:     []*suggestionstore.Suggestion{suggestion(1, 1, "a"), suggestion(2, 2, "b")},
+			wantMore: true,
+		},
+		{
+			name: "stray done edits between edits",
+			events: []Event{
+				doneEdit(), lines(1, 1), text("a"), doneEdit(), doneEdit(),
+				begin(), lines(2, 2), text("b"), doneEdit(),
+				doneStream(),
+			},
+			want:     []*suggestionstore.Suggestion{suggestion(1, 1, "a"), suggestion(2, 2, "b")},
+			wantMore: true,
+		},
+		{
+			name:   "text outside an edit starts one",
+			events: []Event{text("x"), doneEdit(), doneStream()},
+			want:   []*suggestionstore.Suggestion{{Text: "x"}},
+		},
+		{
+			name: "text after the last edit",
+			events: []Event{
+				lines(1, 1), text("a"), doneEdit(),
+				text("orphan"), doneStream(),
+			},
+			want:     []*suggestionstore.Suggestion{suggestion(1, 1, "a")},
+			wantMore: true,
+		},
+		{
+			name:   "edit cut off by done stream",
+			events: []Event{lines(1, 1), text("a"), doneEdit(), begin(), lines(2, 2), text("half"), doneStream()},
+			want:   []*suggestionstore.Suggestion{suggestion(1, 1, "a")},
+			// More sees the BeginEdit; the edit it starts is dropped.
+			wantMore: true,
+		},
+		{
+			name:   "unterminated edit at end of stream",
+			events: []Event{lines(1, 1), text("half")},
+			want:   nil,
+		},
+		{
+			name:    "edit cut off by stream error",
+			events:  []Event{lines(1, 1), text("half")},
+			err:     errReset,
+			want:    nil,
+			wantErr: errReset,
+		},
+		{
+			name:     "error after a complete edit",
+			events:   []Event{lines(1, 1), text("a"), doneEdit()},
+			err:      errReset,
+			want:     []*suggestionstore.Suggestion{suggestion(1, 1, "a")},
+			wantErr:  errReset,
+			wantMore: false,
+		},
+		{
+			name:   "empty stream",
+			events: []Event{doneStream()},
+			want:   nil,
+		},
+		{
+			name: "leading newline removed",
+			events: []Event{
+				{Kind: EventRange, Range: &suggestionstore.RangeInfo{StartLine: 2, EndLine: 2}, BindingID: "b", ShouldRemoveLeadingEol: true},
+				text("\n"), text("line"), doneEdit(), doneStream(),
+			},
+			want: []*suggestionstore.Suggestion{{Text: "line", Range: &suggestionstore.RangeInfo{StartLine: 2, EndLine: 2}, BindingID: "b", ShouldRemoveLeadingEol: true}},
+		},
+		{
+			name: "leading CRLF removed once",
+			events: []Event{
+				{Kind: EventRange, Range: &suggestionstore.RangeInfo{StartLine: 2, EndLine: 2}, BindingID: "b", ShouldRemoveLeadingEol: true},
+				text("\r\n\r\nline"), doneEdit(), doneStream(),
+			},
+			want: []*suggestionstore.Suggestion{{Text: "\r\nline", Range: &suggestionstore.RangeInfo{StartLine: 2, EndLine: 2}, BindingID: "b", ShouldRemoveLeadingEol: true}},
+		},
+		{
+			name:   "leading newline kept unless asked",
+			events: []Event{lines(2, 2), text("\nline"), doneEdit(), doneStream()},
+			want:   []*suggestionstore.Suggestion{suggestion(2, 2, "\nline")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser(&replayStream{events: tt.events, err: tt.err})
+
+			var got []*suggestionstore.Suggestion
+			var err error
+			for {
+				var s *suggestionstore.Suggestion
+				s, err = p.Next()
+				if s == nil {
+					break
+				}
+				got = append(got, s)
+				if len(got) == 1 {
+					more, moreErr := p.More()
+					if more != tt.wantMore {
+						t.Errorf("More() = %v, want %v", more, tt.wantMore)
+					}
+					if moreErr != nil {
+						err = moreErr
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("suggestions = %+v, want %+v", describe(got), describe(tt.want))
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func describe(suggestions []*suggestionstore.Suggestion) []suggestionstore.Suggestion {
+	out := make([]suggestionstore.Suggestion, len(suggestions))
+	for i, s := range suggestions {
+		out[i] = *s
+	}
+	return out
+}
@@ -0,0 +1,262 @@
+package completion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Race sends each request to several backends at once and returns the stream of the
+// first one to produce a usable edit. The others are cancelled.
+type Race struct {
+	completers []Completer
+	logger     *slog.Logger
+
+	mu    sync.Mutex
+	stats map[string]*backendStats
+}
+
+// BackendStats summarizes how one backend fared in races.
+type BackendStats struct {
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+	Wins     int    `json:"wins"`
+	Empty    int    `json:"empty"`
+	Errors   int    `json:"errors"`
+	// AvgLatency is the mean time to a finished answer, usable or not, over the
+	// requests where the backend finished before being cancelled.
+	AvgLatency  string `json:"avg_latency,omitempty"`
+	LastLatency string `json:"last_latency,omitempty"`
+}
+
+type backendStats struct {
+	requests, wins, empty, errors int
+	finished                      int
+	total, last                   time.Duration
+}
+
+func NewRace(logger *slog.Logger, completers ...Completer) *Race {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	r := &Race{completers: completers, logger: logger, stats: make(map[string]*backendStats)}
+	for _, c := range completers {
+		r.stats[c.Name()] = &backendStats{}
+	}
+	return r
+}
+
+// Name implements Completer.
+func (r *Race) Name() string {
+	names := make([]string, len(r.completers))
+	for i, c := range r.completers {
+		names[i] = c.Name()
+	}
+	return "race(" + strings.Join(names, ",") + ")"
+}
+
+// raceResult is what one backend produced before it either had a usable edit or finished.
+type raceResult struct {
+	index    int
+	stream   Stream
+	buffered []Event
+	usable   bool
+	err      error
+	latency  time.Duration
+}
+
+// Complete implements Completer. It fails only if every backend fails; if they all
+// finish without an edit the returned stream is empty.
+func (r *Race) Complete(ctx context.Context, req *Request) (Stream, error) {
+	start := time.Now()
+	results := make(chan raceResult, len(r.completers))
+	cancels := make([]context.CancelFunc, len(r.completers))
+
+	for i, c := range r.completers {
+		backendCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		go func(i int, c Completer) {
+			res := firstEdit(backendCtx, c, req)
+			res.index = i
+			res.latency = time.Since(start)
+			results <- res
+		}(i, c)
+	}
+
+	var errs []error
+	for pending := len(r.completers); pending > 0; pending-- {
+		res := <-results
+		name := r.completers[res.index].Name()
+
+		if !res.usable {
+			cancels[res.index]()
+			if res.stream != nil {
+				res.stream.Close()
+			}
+			if res.err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, res.err))
+			}
+			r.record(name, res, false)
+			continue
+		}
+
+		r.record(name, res, true)
+		for i, cancel := range cancels {
+			if i != res.index {
+				cancel()
+			}
+		}
+		// Losers still report back; release their streams without holding up the winner.
+		go r.drain(results, pending-1)
+
+		r.logger.Info("Completion race won", "backend", name, "latency", res.latency)
+		return &raceStream{Stream: res.stream, buffered: res.buffered, cancel: cancels[res.index]}, nil
+	}
+
+	if len(errs) == len(r.completers) {
+		return nil, errors.Join(errs...)
+	}
+	r.logger.Info("Completion race finished without a suggestion", "latency", time.Since(start))
+	return &raceStream{buffered: []Event{{Kind: EventDoneStream}}}, nil
+}
+
+// firstEdit reads c's stream until the end of its first edit that replaces a range or
+// inserts text.
+func firstEdit(ctx context.Context, c Completer, req *Request) raceResult {
+	stream, err := c.Complete(ctx, req)
+	if err != nil {
+		return raceResult{err: err}
+	}
+
+	res := raceResult{stream: stream}
+	hasContent := false
+	for stream.Receive() {
+		event := stream.Event()
+		res.buffered = append(res.buffered, event)
+
+		switch event.Kind {
+		case EventBeginEdit:
+			hasContent = false
+		case EventRange:
+			hasContent = true
+		case EventText:
+			hasContent = hasContent || event.Text != ""
+		case EventDoneEdit:
+			if hasContent {
+				res.usable = true
+				return res
+			}
+		}
+		if event.Kind == EventDoneStream {
+			break
+		}
+	}
+	res.err = stream.Err()
+	return res
+}
+
+func (r *Race) drain(results <-chan raceResult, n int) {
+	for ; n > 0; n-- {
+		res := <-results
+		if res.stream != nil {
+			res.stream.Close()
+		}
+		r.record(r.completers[res.index].Name(), res, false)
+	}
+}
+
+// record updates a backend's stats. Results cut short by cancellation count as
+// requests but not towards latency.
+func (r *Race) record(name string, res raceResult, won bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.stats[name]
+	s.requests++
+	cancelled := res.err != nil && errors.Is(res.err, context.Canceled)
+	switch {
+	case won:
+		s.wins++
+	case cancelled:
+		return
+	case res.err != nil:
+		s.errors++
+	default:
+		s.empty++
+	}
+	if res.latency > 0 {
+		s.finished++
+		s.total += res.latency
+		s.last = res.latency
+	}
+}
+
+// Stats reports per-backend results in the order the backends were given.
+func (r *Race) Stats() []BackendStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]BackendStats, len(r.completers))
+	for i, c := range r.completers {
+		s := r.stats[c.Name()]
+		stats[i] = BackendStats{
+			Name:     c.Name(),
+			Requests: s.requests,
+			Wins:     s.wins,
+			Empty:    s.empty,
+			Errors:   s.errors,
+		}
+		if s.finished > 0 {
+			stats[i].AvgLatency = (s.total / time.Duration(s.finished)).Round(time.Millisecond).String()
+			stats[i].LastLatency = s.last.Round(time.Millisecond).String()
+		}
+	}
+	return stats
+}
+
+// raceStream replays the events the winner produced during the race, then continues
+// with the rest of its stream.
+type raceStream struct {
+	Stream
+	buffered []Event
+	event    Event
+	cancel   context.CancelFunc
+}
+
+func (s *raceStream) Receive() bool {
+	if len(s.buffered) > 0 {
+		s.event, s.buffered = s.buffered[0], s.buffered[1:]
+		return true
+	}
+	if s.Stream == nil || !s.Stream.Receive() {
+		return false
+	}
+	s.event = s.Stream.Event()
+	return true
+}
+
+func (s *raceStream) Event() Event {
+	return s.event
+}
+
+func (s *raceStream) Err() error {
+	if s.Stream == nil {
+		return nil
+	}
+	return s.Stream.Err()
+}
+
+func (s *raceStream) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.Stream == nil {
+		return nil
+	}
+	return s.Stream.Close()
+}
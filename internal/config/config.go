@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config is the optional JSON config file read at startup. Every field may be left
+// out; flags and environment variables take precedence over values set here.
+type Config struct {
+	Credentials Credentials `json:"credentials"`
+	Auth        Auth        `json:"auth"`
+	Upstream    Upstream    `json:"upstream"`
+	Retry       Retry       `json:"retry"`
+	Breaker     Breaker     `json:"breaker"`
+	Transport   Transport   `json:"transport"`
+
+	// Backend selects the completion backend: "cursor" (default) or "fim". Backends
+	// lists several that are raced against each other, and takes precedence.
+	Backend  string   `json:"backend,omitempty"`
+	Backends []string `json:"backends,omitempty"`
+	FIM      FIM      `json:"fim"`
+	Shadow   Shadow   `json:"shadow"`
+	Context  Context  `json:"context"`
+	Index    Index    `json:"index"`
+}
+
+type Credentials struct {
+	// Sources is the order credential providers are tried in, e.g. ["env", "vscdb"].
+	Sources     []string `json:"sources,omitempty"`
+	TokenFile   string   `json:"token_file,omitempty"`
+	AccessToken string   `json:"access_token,omitempty"`
+	MachineID   string   `json:"machine_id,omitempty"`
+	// DeriveMachineID derives a machine ID from the host name for credentials that
+	// have none, instead of failing.
+	DeriveMachineID bool `json:"derive_machine_id,omitempty"`
+}
+
+// Auth configures how an expiring access token is refreshed.
+type Auth struct {
+	Endpoint string `json:"endpoint,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// Upstream configures which Cursor API endpoints are used.
+type Upstream struct {
+	BaseURL      string   `json:"base_url,omitempty"`
+	FallbackURLs []string `json:"fallback_urls,omitempty"`
+	// RecordDir receives a fixture per StreamCpp call; ReplayDir serves them back
+	// instead of calling the API.
+	RecordDir string `json:"record_dir,omitempty"`
+	ReplayDir string `json:"replay_dir,omitempty"`
+	// Filesync sends synced documents as edits once the API has seen them. It is
+	// experimental and unverified.
+	Filesync bool `json:"filesync,omitempty"`
+}
+
+// Retry configures retries of transient upstream failures. Zero values keep the defaults.
+type Retry struct {
+	MaxAttempts      int `json:"max_attempts,omitempty"`
+	InitialBackoffMs int `json:"initial_backoff_ms,omitempty"`
+	MaxBackoffMs     int `json:"max_backoff_ms,omitempty"`
+}
+
+// Breaker configures the circuit breaker around the Cursor API. Zero values keep the defaults.
+type Breaker struct {
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	OpenSeconds      int `json:"open_seconds,omitempty"`
+}
+
+// Transport configures how the Cursor API is reached: proxy, TLS trust and timeouts.
+// An empty proxy_url falls back to HTTPS_PROXY and NO_PROXY.
+type Transport struct {
+	ProxyURL              string   `json:"proxy_url,omitempty"`
+	NoProxy               string   `json:"no_proxy,omitempty"`
+	CAFiles               []string `json:"ca_files,omitempty"`
+	ClientCert            string   `json:"client_cert,omitempty"`
+	ClientKey             string   `json:"client_key,omitempty"`
+	DialTimeoutMs         int      `json:"dial_timeout_ms,omitempty"`
+	TLSHandshakeTimeoutMs int      `json:"tls_handshake_timeout_ms,omitempty"`
+	FirstByteTimeoutMs    int      `json:"first_byte_timeout_ms,omitempty"`
+	// WarmAfterIdleSeconds re-warms the connection after this much idle time; -1 disables.
+	WarmAfterIdleSeconds int `json:"warm_after_idle_seconds,omitempty"`
+}
+
+// FIM configures the fill-in-the-middle backend for OpenAI-compatible local servers
+// such as llama.cpp server and Ollama.
+type FIM struct {
+	BaseURL     string   `json:"base_url,omitempty"`
+	Model       string   `json:"model,omitempty"`
+	APIKey      string   `json:"api_key,omitempty"`
+	Template    string   `json:"template,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature float64  `json:"temperature,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	PrefixLines int      `json:"prefix_lines,omitempty"`
+	SuffixLines int      `json:"suffix_lines,omitempty"`
+	TimeoutMs   int      `json:"timeout_ms,omitempty"`
+}
+
+// Shadow sends every request to a secondary backend in the background and logs its
+// answer next to the primary's, without ever showing it.
+type Shadow struct {
+	Backend   string `json:"backend,omitempty"`
+	LogFile   string `json:"log_file,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+}
+
+// Context bounds the context sent besides the current file. Zero values keep the defaults.
+type Context struct {
+	// AdditionalFilesBytes is the budget for visible ranges of other open files;
+	// -1 sends none.
+	AdditionalFilesBytes int `json:"additional_files_bytes,omitempty"`
+	MaxAdditionalFiles   int `json:"max_additional_files,omitempty"`
+}
+
+// Index configures the local workspace index that supplies related code chunks.
+// Zero values keep the defaults.
+type Index struct {
+	Disabled      bool `json:"disabled,omitempty"`
+	MaxFiles      int  `json:"max_files,omitempty"`
+	TopChunks     int  `json:"top_chunks,omitempty"`
+	RescanSeconds int  `json:"rescan_seconds,omitempty"`
+}
+
+// DefaultPath returns $XDG_CONFIG_HOME/cursor-tab/config.json, falling back to ~/.config.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "cursor-tab", "config.json")
+}
+
+// Load reads the config file at path. A missing file yields an empty config and an
+// error wrapping os.ErrNotExist, so callers can decide whether that matters.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return &Config{}, fmt.Errorf("error parsing config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
@@ -4,40 +4,62 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
-	"strings"
 )
 
-func GetAccessToken() (string, error) {
-	homeDir := os.Getenv("HOME")
-	dbPath := fmt.Sprintf("%s/Library/Application Support/Cursor/User/globalStorage/state.vscdb", homeDir)
+// machineIDKeys are tried in order; macOS installs use the first, Linux installs the second.
+var machineIDKeys = []string{"telemetry.macMachineId", "telemetry.machineId"}
 
-	cmd := exec.Command("sqlite3", dbPath, "SELECT value FROM ItemTable WHERE key = 'cursorAuth/accessToken';")
-	out, err := cmd.CombinedOutput()
+func GetAccessToken() (string, error) {
+	creds, err := StateDBProvider{}.Credentials()
 	if err != nil {
 		return "", fmt.Errorf("error getting access token: %w", err)
 	}
 
-	return strings.TrimSpace(string(out)), nil
+	return creds.AccessToken, nil
 }
 
 func GetMachineID() (string, error) {
-	homeDir := os.Getenv("HOME")
-	dbPath := fmt.Sprintf("%s/Library/Application Support/Cursor/User/globalStorage/state.vscdb", homeDir)
-
-	cmd := exec.Command("sqlite3", dbPath, "SELECT value FROM ItemTable WHERE key = 'telemetry.macMachineId';")
-	out, err := cmd.CombinedOutput()
+	creds, err := StateDBProvider{}.Credentials()
 	if err != nil {
 		return "", fmt.Errorf("error getting machine ID: %w", err)
 	}
 
-	return strings.TrimSpace(string(out)), nil
+	return creds.MachineID, nil
+}
+
+// readStateDBCredentials reads the access token, refresh token and machine ID from a state.vscdb file.
+func readStateDBCredentials(path string) (*Credentials, error) {
+	keys := append([]string{"cursorAuth/accessToken", "cursorAuth/refreshToken"}, machineIDKeys...)
+	items, err := readItems(path, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	token := items["cursorAuth/accessToken"]
+	if token == "" {
+		return nil, fmt.Errorf("not signed in to Cursor (no access token in %s)", path)
+	}
+
+	for _, key := range machineIDKeys {
+		if id := items[key]; id != "" {
+			return &Credentials{
+				AccessToken:  token,
+				MachineID:    id,
+				RefreshToken: items["cursorAuth/refreshToken"],
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no machine ID in %s", path)
 }
 
 func GetCursorVersion() (string, error) {
-	packagePath := "/Applications/Cursor.app/Contents/Resources/app/package.json"
+	pkgJSON, err := FindPackageJSON()
+	if err != nil {
+		return "0.45.0", nil
+	}
 
-	data, err := os.ReadFile(packagePath)
+	data, err := os.ReadFile(pkgJSON.Path)
 	if err != nil {
 		return "0.45.0", nil
 	}
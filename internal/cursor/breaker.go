@@ -0,0 +1,170 @@
+package cursor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// ErrCircuitOpen is returned without calling the API while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("Cursor API circuit breaker is open")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerOptions configures the circuit breaker around the API. Zero values take defaults.
+type BreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures or rate-limit responses
+	// that opens the circuit.
+	FailureThreshold int
+	// OpenFor is how long the circuit stays open before a single probe request is let through.
+	OpenFor time.Duration
+}
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenFor          = 30 * time.Second
+)
+
+// BreakerStatus is a snapshot of the circuit breaker for status reporting.
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+	LastFailure         string       `json:"last_failure,omitempty"`
+}
+
+// breaker stops every keystroke from waiting on an API that is down or rate-limiting
+// us. After enough consecutive failures it opens and requests fail immediately; once
+// OpenFor has passed one request is let through as a probe, and its outcome decides
+// whether the circuit closes again or stays open.
+type breaker struct {
+	threshold int
+	openFor   time.Duration
+	logger    *slog.Logger
+
+	mu          sync.Mutex
+	state       BreakerState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	lastFailure string
+}
+
+func newBreaker(opts BreakerOptions, logger *slog.Logger) *breaker {
+	b := &breaker{
+		threshold: opts.FailureThreshold,
+		openFor:   opts.OpenFor,
+		logger:    logger,
+		state:     BreakerClosed,
+	}
+	if b.threshold <= 0 {
+		b.threshold = defaultFailureThreshold
+	}
+	if b.openFor <= 0 {
+		b.openFor = defaultOpenFor
+	}
+	return b
+}
+
+// allow reports whether a request may go ahead. In the half-open state only one
+// probe is allowed at a time.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		wait := b.openFor - time.Since(b.openedAt)
+		if wait > 0 {
+			return fmt.Errorf("%w, retrying in %s", ErrCircuitOpen, wait.Round(time.Second))
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w, probe in progress", ErrCircuitOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record feeds the outcome of an allowed request back into the breaker.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	switch {
+	case err == nil:
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.transition(BreakerClosed)
+		}
+
+	case !countsAsFailure(err):
+		// A caller that gave up, or a request the API rejected on its merits, says
+		// nothing about upstream health. A cancelled probe is simply retried by the
+		// next request.
+
+	default:
+		b.failures++
+		b.lastFailure = err.Error()
+		if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+			b.openedAt = time.Now()
+			if b.state != BreakerOpen {
+				b.transition(BreakerOpen)
+			}
+		}
+	}
+}
+
+func (b *breaker) transition(to BreakerState) {
+	b.logger.Warn("Cursor API circuit breaker state changed",
+		"from", b.state,
+		"to", to,
+		"consecutive_failures", b.failures,
+		"last_failure", b.lastFailure)
+	b.state = to
+}
+
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastFailure:         b.lastFailure,
+	}
+	if b.state != BreakerClosed {
+		status.OpenedAt = optionalTime(b.openedAt)
+	}
+	return status
+}
+
+// countsAsFailure reports whether an error says the upstream is unhealthy or
+// rate-limiting us.
+func countsAsFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch connect.CodeOf(err) {
+	case connect.CodeUnavailable, connect.CodeDeadlineExceeded, connect.CodeResourceExhausted,
+		connect.CodeInternal, connect.CodeUnknown, connect.CodeAborted:
+		return true
+	}
+	return false
+}
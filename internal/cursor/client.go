@@ -1,33 +1,117 @@
+// Package cursor is the completion backend for the Cursor API: it finds the user's
+// Cursor credentials, keeps them fresh and streams completions from StreamCpp.
+//
+// Filesync, sending a document as its edits once the API has seen it in full, is
+// experimental. Its use of the protocol was worked out from the message definitions
+// and has not been verified against Cursor's own client, so any failed request with
+// edits is retried with full contents.
 package cursor
 
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"connectrpc.com/connect"
 	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
 	"github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1/aiserverv1connect"
 )
 
+// APIBaseURL is the default upstream endpoint.
 const APIBaseURL = "https://api4.cursor.sh"
 
 type Client struct {
-	aiClient      aiserverv1connect.AiServiceClient
-	accessToken   string
-	machineID     string
+	endpoints     *endpointSet
+	httpClient    *http.Client
 	clientVersion string
+	logger        *slog.Logger
+
+	// credentials is swapped atomically so in-flight requests keep the token they started with.
+	credentials   atomic.Pointer[Credentials]
+	provider      CredentialProvider
+	refreshMu     sync.Mutex
+	refreshBefore time.Duration
+	authEndpoint  string
+	authClientID  string
+
+	retry   RetryPolicy
+	breaker *breaker
+	lastErr atomic.Pointer[UpstreamError]
+
+	warmAfterIdle time.Duration
+	// lastUsed is the UnixNano time of the last request or warm-up.
+	lastUsed atomic.Int64
+	latency  latencyStats
+
+	recordDir string
+	replayDir string
+	inProcess bool
+
+	// filesync is nil unless Options.Filesync is set.
+	filesync *filesyncState
 }
 
-func NewClient() (*Client, error) {
-	accessToken, err := GetAccessToken()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %w", err)
+// Options configures NewClient. The zero value reads credentials from state.vscdb.
+type Options struct {
+	Credentials CredentialProvider
+
+	// BaseURL is the Cursor API endpoint, APIBaseURL if empty. FallbackURLs are tried
+	// in order when it is unreachable or returns server errors.
+	BaseURL      string
+	FallbackURLs []string
+
+	// AuthEndpoint and AuthClientID are used to exchange cursorAuth/refreshToken for a
+	// new access token. They default to DefaultAuthEndpoint and DefaultAuthClientID.
+	AuthEndpoint string
+	AuthClientID string
+	// RefreshBefore is how long before expiry the access token is renewed.
+	RefreshBefore time.Duration
+
+	// Retry governs retries of transient failures; zero fields take DefaultRetryPolicy values.
+	Retry RetryPolicy
+	// Breaker configures the circuit breaker that fails fast while the API is down.
+	Breaker BreakerOptions
+	// Transport configures proxying, TLS trust and connection timeouts.
+	Transport TransportOptions
+
+	// RecordDir, if set, receives a fixture file for every StreamCpp call. ReplayDir
+	// answers StreamCpp from such fixtures instead of the network; credentials are
+	// then optional.
+	RecordDir string
+	ReplayDir string
+	// Handler, if set, serves API calls in process instead of the network, e.g. a
+	// fake upstream for plugin development. Credentials are then optional.
+	Handler aiserverv1connect.AiServiceHandler
+
+	// Filesync sends synced documents the API has already seen as edits rather than
+	// full contents. It is experimental and unverified against the real API.
+	Filesync bool
+
+	Logger *slog.Logger
+}
+
+func NewClient(opts Options) (*Client, error) {
+	provider := opts.Credentials
+	if provider == nil {
+		provider = StateDBProvider{}
 	}
 
-	machineID, err := GetMachineID()
+	inProcess := opts.ReplayDir != "" || opts.Handler != nil
+	creds, err := provider.Credentials()
+	if err != nil && inProcess {
+		creds, err = &Credentials{Source: "none"}, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get machine ID: %w", err)
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	if creds.MachineID == "" && !inProcess {
+		return nil, missingMachineID(creds.Source)
 	}
 
 	clientVersion, err := GetCursorVersion()
@@ -35,27 +119,139 @@ func NewClient() (*Client, error) {
 		return nil, fmt.Errorf("failed to get Cursor version: %w", err)
 	}
 
-	httpClient := &http.Client{}
-	aiClient := aiserverv1connect.NewAiServiceClient(httpClient, APIBaseURL)
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = APIBaseURL
+	}
+
+	httpClient, err := newHTTPClient(opts.Transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure transport: %w", err)
+	}
+	if opts.RecordDir != "" {
+		if err := os.MkdirAll(opts.RecordDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create record directory: %w", err)
+		}
+	}
+	handler := opts.Handler
+	if opts.ReplayDir != "" {
+		handler, err = newReplayHandler(opts.ReplayDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load replay fixtures: %w", err)
+		}
+	}
+	if handler != nil {
+		httpClient = &http.Client{Transport: newHandlerTransport(handler)}
+	}
+	endpoints := newEndpointSet(httpClient, append([]string{baseURL}, opts.FallbackURLs...))
 
-	return &Client{
-		aiClient:      aiClient,
-		accessToken:   accessToken,
-		machineID:     machineID,
+	c := &Client{
+		endpoints:     endpoints,
+		httpClient:    httpClient,
 		clientVersion: clientVersion,
-	}, nil
+		logger:        opts.Logger,
+		provider:      provider,
+		refreshBefore: opts.RefreshBefore,
+		authEndpoint:  opts.AuthEndpoint,
+		authClientID:  opts.AuthClientID,
+		retry:         opts.Retry.withDefaults(),
+		warmAfterIdle: opts.Transport.WarmAfterIdle,
+		recordDir:     opts.RecordDir,
+		replayDir:     opts.ReplayDir,
+		inProcess:     inProcess,
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if c.refreshBefore <= 0 {
+		c.refreshBefore = DefaultRefreshBefore
+	}
+	if c.warmAfterIdle == 0 {
+		c.warmAfterIdle = DefaultWarmAfterIdle
+	}
+	if c.authEndpoint == "" {
+		c.authEndpoint = DefaultAuthEndpoint
+	}
+	if c.authClientID == "" {
+		c.authClientID = DefaultAuthClientID
+	}
+	if opts.Filesync {
+		c.filesync = newFilesyncState()
+	}
+	c.breaker = newBreaker(opts.Breaker, c.logger)
+	c.credentials.Store(creds)
+
+	return c, nil
 }
 
-func (c *Client) StreamCpp(ctx context.Context, req *aiserverv1.StreamCppRequest) (*connect.ServerStreamForClient[aiserverv1.StreamCppResponse], error) {
-	connectReq := connect.NewRequest(req)
-	connectReq.Header().Set("authorization", "Bearer "+c.accessToken)
-	connectReq.Header().Set("x-cursor-client-version", c.clientVersion)
-	connectReq.Header().Set("x-cursor-machine-id", c.machineID)
+// CredentialSource names the provider the client's credentials came from.
+func (c *Client) CredentialSource() string {
+	return c.credentials.Load().Source
+}
+
+// StreamCpp starts a completion stream. While the circuit breaker is open it fails
+// immediately with ErrCircuitOpen. An access token that is about to expire is
+// renewed first, a call rejected as unauthenticated is retried once with fresh
+// credentials, and transient failures before the first response are retried according
+// to the retry policy, within the bounds of ctx.
+func (c *Client) StreamCpp(ctx context.Context, req *aiserverv1.StreamCppRequest) (*Stream, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
 
-	stream, err := c.aiClient.StreamCpp(ctx, connectReq)
+	stream, err := c.streamCppWithRetries(ctx, req)
+	c.breaker.record(err)
 	if err != nil {
+		c.recordError(err)
 		return nil, fmt.Errorf("failed to call StreamCpp: %w", err)
 	}
 
 	return stream, nil
 }
+
+func (c *Client) streamCppWithRetries(ctx context.Context, req *aiserverv1.StreamCppRequest) (*Stream, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var stream *Stream
+		stream, err = c.streamCppOnce(ctx, req)
+		if err == nil {
+			return stream, nil
+		}
+
+		if attempt >= c.retry.MaxAttempts || ctx.Err() != nil || !isRetryable(err) {
+			break
+		}
+		delay := c.retry.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			break
+		}
+
+		c.logger.Debug("Retrying StreamCpp", "attempt", attempt+1, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+
+	return nil, err
+}
+
+func (c *Client) streamCppOnce(ctx context.Context, req *aiserverv1.StreamCppRequest) (*Stream, error) {
+	creds := c.currentCredentials(ctx)
+
+	stream, err := c.streamCpp(ctx, req, creds)
+	if connect.CodeOf(err) == connect.CodeUnauthenticated {
+		c.logger.Warn("Cursor API rejected access token, refreshing", "source", creds.Source)
+		fresh, refreshErr := c.refresh(ctx, creds)
+		if refreshErr != nil {
+			c.logger.Error("Failed to refresh Cursor access token", "error", refreshErr)
+			return nil, err
+		}
+		stream, err = c.streamCpp(ctx, req, fresh)
+	}
+
+	return stream, err
+}
@@ -0,0 +1,321 @@
+package cursor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+// CompleterName is the name the Cursor backend reports to the completion package.
+const CompleterName = "cursor"
+
+// Name implements completion.Completer.
+func (c *Client) Name() string {
+	return CompleterName
+}
+
+// Complete implements completion.Completer on top of StreamCpp.
+// With filesync enabled, a synced document is sent as its edits since the API last saw
+// it. Filesync is experimental and its protocol unverified, so a request with edits that
+// fails for any reason is sent again with the full contents.
+func (c *Client) Complete(ctx context.Context, req *completion.Request) (completion.Stream, error) {
+	streamReq := newStreamCppRequest(req)
+	incremental := false
+	if c.filesync != nil && req.Document != nil {
+		incremental = c.filesync.applyFilesync(streamReq, req.Document)
+	}
+
+	stream, err := c.StreamCpp(ctx, streamReq)
+	if err != nil && incremental && ctx.Err() == nil {
+		c.logger.Warn("Cursor API failed filesync update, resending full contents",
+			"file_path", req.FilePath, "version", req.Document.Version, "error", err)
+		incremental = false
+		c.filesync.forget(req.Document)
+		streamReq = newStreamCppRequest(req)
+		c.filesync.applyFilesync(streamReq, req.Document)
+		stream, err = c.StreamCpp(ctx, streamReq)
+		if err == nil && c.filesync.reject() {
+			c.logger.Warn("Cursor API keeps rejecting filesync updates, sending full contents from now on")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.filesync != nil && req.Document != nil {
+		c.filesync.record(req.Document, incremental)
+	}
+	return &eventStream{stream: stream}, nil
+}
+
+// Name implements completion.Completer.
+func (m *Manager) Name() string {
+	return CompleterName
+}
+
+// Complete implements completion.Completer with the managed client, failing while it
+// has not been created yet.
+func (m *Manager) Complete(ctx context.Context, req *completion.Request) (completion.Stream, error) {
+	client, err := m.Client()
+	if err != nil {
+		return nil, fmt.Errorf("cursor client not initialized: %w", err)
+	}
+	return client.Complete(ctx, req)
+}
+
+func newStreamCppRequest(req *completion.Request) *aiserverv1.StreamCppRequest {
+	giveDebug := true
+	supportsCpt := true
+	supportsCrlfCpt := true
+	return &aiserverv1.StreamCppRequest{
+		CurrentFile: &aiserverv1.CurrentFileInfo{
+			Contents:              req.FileContents,
+			RelativeWorkspacePath: req.FilePath,
+			LanguageId:            req.LanguageID,
+			TotalNumberOfLines:    int32(strings.Count(req.FileContents, "\n") + 1),
+			WorkspaceRootPath:     req.WorkspacePath,
+			CursorPosition: &aiserverv1.CursorPosition{
+				Line:   req.Line,
+				Column: req.Column,
+			},
+			Diagnostics: diagnostics(req.Diagnostics),
+			TopChunks:   topChunks(req.WorkspacePath, req.RelatedChunks),
+		},
+		CppIntentInfo: &aiserverv1.CppIntentInfo{
+			Source: "typing",
+		},
+		DiffHistory:         diffHistory(req.RecentEdits),
+		FileDiffHistories:   fileDiffHistories(req.RecentEdits),
+		MergedDiffHistories: mergedDiffHistories(req.RecentEdits),
+		LinterErrors:        linterErrors(req),
+		AdditionalFiles:     additionalFiles(req.AdditionalFiles),
+		SupportsCpt:         &supportsCpt,
+		SupportsCrlfCpt:     &supportsCrlfCpt,
+		GiveDebugOutput:     &giveDebug,
+	}
+}
+
+// diffHistory interleaves the diffs of all files by time, each prefixed with its
+// file name.
+func diffHistory(files []completion.FileEdits) []string {
+	type entry struct {
+		text string
+		at   time.Time
+	}
+	var entries []entry
+	for _, file := range files {
+		for _, diff := range file.Diffs {
+			entries = append(entries, entry{file.Path + "\n" + diff.Text, diff.At})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].at.Before(entries[j].at)
+	})
+
+	history := make([]string, len(entries))
+	for i, e := range entries {
+		history[i] = e.text
+	}
+	return history
+}
+
+func fileDiffHistories(files []completion.FileEdits) []*aiserverv1.CppFileDiffHistory {
+	var histories []*aiserverv1.CppFileDiffHistory
+	for _, file := range files {
+		history := &aiserverv1.CppFileDiffHistory{FileName: file.Path}
+		for _, diff := range file.Diffs {
+			history.DiffHistory = append(history.DiffHistory, diff.Text)
+			history.DiffHistoryTimestamps = append(history.DiffHistoryTimestamps, unixMillis(diff.At))
+		}
+		histories = append(histories, history)
+	}
+	return histories
+}
+
+func mergedDiffHistories(files []completion.FileEdits) []*aiserverv1.CppFileDiffHistory {
+	var histories []*aiserverv1.CppFileDiffHistory
+	for _, file := range files {
+		latest := file.Diffs[len(file.Diffs)-1].At
+		histories = append(histories, &aiserverv1.CppFileDiffHistory{
+			FileName:              file.Path,
+			DiffHistory:           []string{file.Merged},
+			DiffHistoryTimestamps: []float64{unixMillis(latest)},
+		})
+	}
+	return histories
+}
+
+func diagnostics(diags []completion.Diagnostic) []*aiserverv1.Diagnostic {
+	var out []*aiserverv1.Diagnostic
+	for _, d := range diags {
+		out = append(out, &aiserverv1.Diagnostic{
+			Message:            d.Message,
+			Range:              cursorRange(d.Range),
+			Severity:           aiserverv1.DiagnosticSeverity(d.Severity),
+			RelatedInformation: relatedInformation(d.Related),
+		})
+	}
+	return out
+}
+
+// linterErrors carries the same diagnostics in the form older models read. The file
+// contents are not repeated; they are already in current_file.
+func linterErrors(req *completion.Request) *aiserverv1.LinterErrors {
+	if len(req.Diagnostics) == 0 {
+		return nil
+	}
+	linterErrors := &aiserverv1.LinterErrors{RelativeWorkspacePath: req.FilePath}
+	for _, d := range req.Diagnostics {
+		linterError := &aiserverv1.LinterError{
+			Message:            d.Message,
+			Range:              cursorRange(d.Range),
+			RelatedInformation: relatedInformation(d.Related),
+		}
+		if d.Source != "" {
+			source := d.Source
+			linterError.Source = &source
+		}
+		if d.Severity != 0 {
+			severity := aiserverv1.DiagnosticSeverity(d.Severity)
+			linterError.Severity = &severity
+		}
+		linterErrors.Errors = append(linterErrors.Errors, linterError)
+	}
+	return linterErrors
+}
+
+func relatedInformation(related []completion.RelatedInformation) []*aiserverv1.RelatedInformation {
+	var out []*aiserverv1.RelatedInformation
+	for _, r := range related {
+		out = append(out, &aiserverv1.RelatedInformation{Message: r.Message, Range: cursorRange(r.Range)})
+	}
+	return out
+}
+
+func cursorRange(r completion.Range) *aiserverv1.CursorRange {
+	return &aiserverv1.CursorRange{
+		StartPosition: &aiserverv1.CursorPosition{Line: r.Start.Line, Column: r.Start.Column},
+		EndPosition:   &aiserverv1.CursorPosition{Line: r.End.Line, Column: r.End.Column},
+	}
+}
+
+func additionalFiles(files []completion.AdditionalFile) []*aiserverv1.AdditionalFile {
+	var out []*aiserverv1.AdditionalFile
+	for _, file := range files {
+		lastViewed := unixMillis(file.LastViewed)
+		additional := &aiserverv1.AdditionalFile{
+			RelativeWorkspacePath: file.Path,
+			IsOpen:                file.IsOpen,
+			LastViewedAt:          &lastViewed,
+		}
+		for _, r := range file.Ranges {
+			additional.VisibleRangeContent = append(additional.VisibleRangeContent, strings.Join(r.Lines, "\n"))
+			additional.StartLineNumberOneIndexed = append(additional.StartLineNumberOneIndexed, r.StartLine)
+			additional.VisibleRanges = append(additional.VisibleRanges, &aiserverv1.LineRange{
+				StartLineNumber:        r.StartLine,
+				EndLineNumberInclusive: r.EndLine,
+			})
+		}
+		out = append(out, additional)
+	}
+	return out
+}
+
+// topChunks converts index hits; the proto's integer score is the BM25 score times 1000.
+// The index reports absolute paths, which are made relative to the workspace.
+func topChunks(workspace string, chunks []completion.Chunk) []*aiserverv1.BM25Chunk {
+	var out []*aiserverv1.BM25Chunk
+	for _, c := range chunks {
+		rel, err := filepath.Rel(workspace, c.Path)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		out = append(out, &aiserverv1.BM25Chunk{
+			Content:      c.Content,
+			Range:        &aiserverv1.SimplestRange{StartLine: int32(c.StartLine), EndLineInclusive: int32(c.EndLine)},
+			Score:        int32(math.Round(c.Score * 1000)),
+			RelativePath: filepath.ToSlash(rel),
+		})
+	}
+	return out
+}
+
+// unixMillis matches the JavaScript Date.now() timestamps Cursor sends.
+func unixMillis(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Millisecond)
+}
+
+// eventStream splits each StreamCppResponse into completion events. A single chunk
+// may carry several parts; they are emitted in the order begin, range, text, done
+// edit, done stream.
+type eventStream struct {
+	stream *Stream
+	queue  []completion.Event
+	event  completion.Event
+}
+
+func (s *eventStream) Receive() bool {
+	for len(s.queue) == 0 {
+		if !s.stream.Receive() {
+			return false
+		}
+		s.queue = chunkEvents(s.stream.Msg())
+	}
+	s.event, s.queue = s.queue[0], s.queue[1:]
+	return true
+}
+
+func (s *eventStream) Event() completion.Event {
+	return s.event
+}
+
+func (s *eventStream) Err() error {
+	return s.stream.Err()
+}
+
+func (s *eventStream) Close() error {
+	return s.stream.Close()
+}
+
+func chunkEvents(resp *aiserverv1.StreamCppResponse) []completion.Event {
+	var events []completion.Event
+
+	if resp.BeginEdit != nil && *resp.BeginEdit {
+		events = append(events, completion.Event{Kind: completion.EventBeginEdit})
+	}
+	if resp.RangeToReplace != nil {
+		event := completion.Event{
+			Kind: completion.EventRange,
+			Range: &suggestionstore.RangeInfo{
+				StartLine:   resp.RangeToReplace.StartLineNumber,
+				StartColumn: 0,
+				EndLine:     resp.RangeToReplace.EndLineNumberInclusive,
+				EndColumn:   -1,
+			},
+		}
+		if resp.BindingId != nil {
+			event.BindingID = *resp.BindingId
+		}
+		if resp.ShouldRemoveLeadingEol != nil {
+			event.ShouldRemoveLeadingEol = *resp.ShouldRemoveLeadingEol
+		}
+		events = append(events, event)
+	}
+	if resp.Text != "" {
+		events = append(events, completion.Event{Kind: completion.EventText, Text: resp.Text})
+	}
+	if resp.DoneEdit != nil && *resp.DoneEdit {
+		events = append(events, completion.Event{Kind: completion.EventDoneEdit})
+	}
+	if resp.DoneStream != nil && *resp.DoneStream {
+		events = append(events, completion.Event{Kind: completion.EventDoneStream})
+	}
+	return events
+}
@@ -0,0 +1,28 @@
+package cursor
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+)
+
+func TestTopChunksRelativePaths(t *testing.T) {
+	workspace := filepath.Join(t.TempDir(), "work")
+	chunks := []completion.Chunk{
+		{Path: filepath.Join(workspace, "internal", "util.go"), StartLine: 1, EndLine: 30, Content: "package util", Score: 1.5},
+		{Path: filepath.Join(workspace, "main.go"), StartLine: 16, EndLine: 45},
+		{Path: filepath.Join(filepath.Dir(workspace), "other", "x.go")},
+	}
+
+	got := topChunks(workspace, chunks)
+	if len(got) != 2 {
+		t.Fatalf("got %d chunks, want the two inside the workspace", len(got))
+	}
+	if got[0].RelativePath != "internal/util.go" || got[1].RelativePath != "main.go" {
+		t.Errorf("paths = %q, %q, want workspace-relative ones", got[0].RelativePath, got[1].RelativePath)
+	}
+	if got[0].Score != 1500 || got[0].Range.StartLine != 1 || got[0].Range.EndLineInclusive != 30 {
+		t.Errorf("chunk = %+v, want score 1500 and lines 1-30", got[0])
+	}
+}
@@ -0,0 +1,184 @@
+package cursor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Credentials are what the Cursor API needs to authenticate a request.
+// Source names the provider they came from and is safe to log.
+type Credentials struct {
+	AccessToken string
+	MachineID   string
+	Source      string
+	// RefreshToken is optional and only used to renew an expiring AccessToken.
+	RefreshToken string
+}
+
+// CredentialProvider is one way of obtaining Cursor credentials.
+type CredentialProvider interface {
+	Name() string
+	Credentials() (*Credentials, error)
+}
+
+// EnvProvider reads CURSOR_ACCESS_TOKEN, CURSOR_MACHINE_ID and CURSOR_REFRESH_TOKEN.
+type EnvProvider struct{}
+
+func (EnvProvider) Name() string { return "env" }
+
+func (p EnvProvider) Credentials() (*Credentials, error) {
+	token := strings.TrimSpace(os.Getenv("CURSOR_ACCESS_TOKEN"))
+	if token == "" {
+		return nil, errors.New("CURSOR_ACCESS_TOKEN is not set")
+	}
+
+	return &Credentials{
+		AccessToken:  token,
+		MachineID:    strings.TrimSpace(os.Getenv("CURSOR_MACHINE_ID")),
+		Source:       p.Name(),
+		RefreshToken: strings.TrimSpace(os.Getenv("CURSOR_REFRESH_TOKEN")),
+	}, nil
+}
+
+// TokenFileProvider reads an access token from a file containing only the token.
+type TokenFileProvider struct {
+	Path string
+}
+
+func (TokenFileProvider) Name() string { return "token-file" }
+
+func (p TokenFileProvider) Credentials() (*Credentials, error) {
+	if p.Path == "" {
+		return nil, errors.New("no token file configured")
+	}
+
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("token file %s is empty", p.Path)
+	}
+
+	return &Credentials{AccessToken: token, Source: p.Name()}, nil
+}
+
+// StaticProvider returns fixed credentials, e.g. ones set in the config file.
+type StaticProvider struct {
+	Source      string
+	AccessToken string
+	MachineID   string
+}
+
+func (p StaticProvider) Name() string { return p.Source }
+
+func (p StaticProvider) Credentials() (*Credentials, error) {
+	if p.AccessToken == "" {
+		return nil, fmt.Errorf("no access token in %s", p.Source)
+	}
+
+	return &Credentials{AccessToken: p.AccessToken, MachineID: p.MachineID, Source: p.Source}, nil
+}
+
+// StateDBProvider reads the credentials Cursor stores in state.vscdb.
+// An empty Path means the database is discovered with FindStateDB.
+type StateDBProvider struct {
+	Path string
+}
+
+func (StateDBProvider) Name() string { return "vscdb" }
+
+func (p StateDBProvider) Credentials() (*Credentials, error) {
+	path := p.Path
+	if path == "" {
+		db, err := FindStateDB()
+		if err != nil {
+			return nil, err
+		}
+		path = db.Path
+	}
+
+	creds, err := readStateDBCredentials(path)
+	if err != nil {
+		return nil, err
+	}
+
+	creds.Source = p.Name()
+	return creds, nil
+}
+
+// CredentialChain tries each provider in order and returns the first credentials found.
+type CredentialChain []CredentialProvider
+
+func (c CredentialChain) Name() string {
+	names := make([]string, len(c))
+	for i, p := range c {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c CredentialChain) Credentials() (*Credentials, error) {
+	var errs []error
+	for _, p := range c {
+		creds, err := p.Credentials()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		return creds, nil
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no credential providers configured")
+	}
+	return nil, fmt.Errorf("no credentials found: %w", errors.Join(errs...))
+}
+
+// MachineIDProvider fills in the machine ID for credentials whose source has none,
+// such as a token file. Without a machine ID to use it fails rather than inventing one.
+type MachineIDProvider struct {
+	CredentialProvider
+	// MachineID is used when the wrapped provider returns none.
+	MachineID string
+	// Derive opts in to deriving a machine ID from the host name when there is no
+	// other. The API then sees an ID Cursor itself would never send.
+	Derive bool
+}
+
+func (p MachineIDProvider) Credentials() (*Credentials, error) {
+	creds, err := p.CredentialProvider.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	if creds.MachineID == "" {
+		creds.MachineID = p.MachineID
+	}
+	if creds.MachineID == "" && p.Derive {
+		creds.MachineID = derivedMachineID()
+	}
+	if creds.MachineID == "" {
+		return nil, missingMachineID(creds.Source)
+	}
+	return creds, nil
+}
+
+func missingMachineID(source string) error {
+	return fmt.Errorf("credentials from %s have no machine ID: set CURSOR_MACHINE_ID or credentials.machine_id "+
+		"(Cursor keeps it as telemetry.machineId in state.vscdb), or set credentials.derive_machine_id "+
+		"to derive one from the host name", source)
+}
+
+// derivedMachineID stands in for Cursor's machine ID on hosts without Cursor installed.
+// It is stable per host so the API sees a consistent client.
+func derivedMachineID() string {
+	host, _ := os.Hostname()
+	sum := sha256.Sum256([]byte("cursor-tab:" + host))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,56 @@
+package cursor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMachineIDProvider(t *testing.T) {
+	tokenOnly := StaticProvider{AccessToken: "token"}
+
+	tests := []struct {
+		name     string
+		provider MachineIDProvider
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "source has one",
+			provider: MachineIDProvider{CredentialProvider: StaticProvider{AccessToken: "token", MachineID: "source"}, MachineID: "fallback"},
+			want:     "source",
+		},
+		{
+			name:     "fallback",
+			provider: MachineIDProvider{CredentialProvider: tokenOnly, MachineID: "fallback"},
+			want:     "fallback",
+		},
+		{
+			name:     "derived when opted in",
+			provider: MachineIDProvider{CredentialProvider: tokenOnly, Derive: true},
+			want:     derivedMachineID(),
+		},
+		{
+			name:     "none",
+			provider: MachineIDProvider{CredentialProvider: tokenOnly},
+			wantErr:  "CURSOR_MACHINE_ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, err := tt.provider.Credentials()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.MachineID != tt.want {
+				t.Errorf("machine ID = %q, want %q", creds.MachineID, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package cursortest provides a scriptable in-process AiService for testing code that
+// talks to the Cursor API, and a cursor.Client wired to it.
+//
+//	srv := cursortest.NewServer(t, cursortest.Script(
+//		cursortest.Edit(3, 3, "fmt.Println(x)"),
+//		cursortest.Delay(20*time.Millisecond),
+//		cursortest.Edit(5, 6, "return nil"),
+//		cursortest.DoneStream(),
+//	))
+//	client := srv.Client(t, cursor.Options{})
+package cursortest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+	"github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1/aiserverv1connect"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+)
+
+// Step is one action of a scripted StreamCpp response. Exactly one field is set.
+type Step struct {
+	Chunk      *aiserverv1.StreamCppResponse
+	Delay      time.Duration
+	Err        error
+	Disconnect bool
+}
+
+// Script joins steps and groups of steps, such as those returned by Edit, into one
+// response.
+func Script(steps ...any) []Step {
+	var script []Step
+	for _, s := range steps {
+		switch s := s.(type) {
+		case Step:
+			script = append(script, s)
+		case []Step:
+			script = append(script, s...)
+		default:
+			panic("cursortest: Script takes Step or []Step")
+		}
+	}
+	return script
+}
+
+func Chunk(resp *aiserverv1.StreamCppResponse) Step {
+	return Step{Chunk: resp}
+}
+
+func BeginEdit() Step {
+	return Chunk(&aiserverv1.StreamCppResponse{BeginEdit: ptr(true)})
+}
+
+func Text(text string) Step {
+	return Chunk(&aiserverv1.StreamCppResponse{Text: text})
+}
+
+// Range sets the 1-indexed, inclusive lines the current edit replaces.
+func Range(startLine, endLine int32) Step {
+	return Chunk(&aiserverv1.StreamCppResponse{
+		RangeToReplace: &aiserverv1.LineRange{
+			StartLineNumber:        startLine,
+			EndLineNumberInclusive: endLine,
+		},
+	})
+}
+
+func DoneEdit() Step {
+	return Chunk(&aiserverv1.StreamCppResponse{DoneEdit: ptr(true)})
+}
+
+func DoneStream() Step {
+	return Chunk(&aiserverv1.StreamCppResponse{DoneStream: ptr(true)})
+}
+
+// Delay pauses the response, e.g. to simulate model latency between chunks.
+func Delay(d time.Duration) Step {
+	return Step{Delay: d}
+}
+
+// Error ends the response with a Connect error.
+func Error(code connect.Code, message string) Step {
+	return Step{Err: connect.NewError(code, errors.New(message))}
+}
+
+// Disconnect drops the connection mid-response without a proper end of stream.
+func Disconnect() Step {
+	return Step{Disconnect: true}
+}
+
+// Edit is the chunk sequence of one edit: range, text and DoneEdit. Follow an Edit
+// with BeginEdit to start another one, as the API does.
+func Edit(startLine, endLine int32, text string) []Step {
+	return []Step{Range(startLine, endLine), Text(text), DoneEdit()}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// Call is a StreamCpp request the server received.
+type Call struct {
+	Request *aiserverv1.StreamCppRequest
+	Header  http.Header
+}
+
+// Server is an AiService whose StreamCpp answers each call with the next queued
+// script. Other methods are unimplemented.
+type Server struct {
+	aiserverv1connect.UnimplementedAiServiceHandler
+
+	// URL is the base URL of the running server.
+	URL string
+
+	mu       sync.Mutex
+	scripts  [][]Step
+	fallback []Step
+	calls    []Call
+}
+
+// NewServer starts a server with the given scripts queued. It is closed when the
+// test ends.
+func NewServer(tb testing.TB, scripts ...[]Step) *Server {
+	tb.Helper()
+
+	s := &Server{scripts: scripts}
+	mux := http.NewServeMux()
+	mux.Handle(aiserverv1connect.NewAiServiceHandler(s))
+	httpServer := httptest.NewServer(mux)
+	tb.Cleanup(httpServer.Close)
+
+	s.URL = httpServer.URL
+	return s
+}
+
+// Push queues a script for the next call.
+func (s *Server) Push(script ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts = append(s.scripts, script)
+}
+
+// SetFallback sets the script used once the queue is empty. Without one, such
+// calls fail with CodeUnimplemented.
+func (s *Server) SetFallback(script ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = script
+}
+
+// Calls returns the requests received so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+func (s *Server) next(call Call) ([]Step, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, call)
+	if len(s.scripts) > 0 {
+		script := s.scripts[0]
+		s.scripts = s.scripts[1:]
+		return script, true
+	}
+	return s.fallback, s.fallback != nil
+}
+
+// StreamCpp implements aiserverv1connect.AiServiceHandler.
+func (s *Server) StreamCpp(ctx context.Context, req *connect.Request[aiserverv1.StreamCppRequest], stream *connect.ServerStream[aiserverv1.StreamCppResponse]) error {
+	script, ok := s.next(Call{Request: req.Msg, Header: req.Header().Clone()})
+	if !ok {
+		return connect.NewError(connect.CodeUnimplemented, errors.New("cursortest: no script queued"))
+	}
+
+	for _, step := range script {
+		switch {
+		case step.Chunk != nil:
+			if err := stream.Send(step.Chunk); err != nil {
+				return err
+			}
+		case step.Delay > 0:
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.Delay):
+			}
+		case step.Err != nil:
+			return step.Err
+		case step.Disconnect:
+			// net/http closes the connection without finishing the response.
+			panic(http.ErrAbortHandler)
+		}
+	}
+	return nil
+}
+
+// Client returns a cursor.Client pointed at the server. Credentials default to a
+// static test token; other options are passed through.
+func (s *Server) Client(tb testing.TB, opts cursor.Options) *cursor.Client {
+	tb.Helper()
+
+	opts.BaseURL = s.URL
+	if opts.Credentials == nil {
+		opts.Credentials = cursor.StaticProvider{
+			Source:      "cursortest",
+			AccessToken: "cursortest-token",
+			MachineID:   "cursortest-machine",
+		}
+	}
+
+	client, err := cursor.NewClient(opts)
+	if err != nil {
+		tb.Fatalf("cursortest: creating client: %v", err)
+	}
+	return client
+}
@@ -0,0 +1,176 @@
+package cursor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Candidate is a location probed while looking for a Cursor installation.
+// Source names the kind of install it belongs to, e.g. "xdg-config" or "flatpak".
+type Candidate struct {
+	Path   string
+	Source string
+}
+
+// searchEnv holds everything discovery depends on so it can be pointed at a fake
+// directory tree instead of the real home directory.
+type searchEnv struct {
+	goos   string
+	home   string
+	getenv func(string) string
+}
+
+func defaultSearchEnv() searchEnv {
+	home := os.Getenv("HOME")
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	return searchEnv{
+		goos:   runtime.GOOS,
+		home:   home,
+		getenv: os.Getenv,
+	}
+}
+
+// stateDBCandidates lists the places Cursor keeps state.vscdb, most likely first.
+func (e searchEnv) stateDBCandidates() []Candidate {
+	const rel = "User/globalStorage/state.vscdb"
+	var candidates []Candidate
+
+	switch e.goos {
+	case "darwin":
+		candidates = append(candidates, Candidate{filepath.Join(e.home, "Library/Application Support/Cursor", rel), "macos"})
+	case "windows":
+		if appData := e.getenv("APPDATA"); appData != "" {
+			candidates = append(candidates, Candidate{filepath.Join(appData, "Cursor", rel), "appdata"})
+		}
+	default:
+		if xdg := e.getenv("XDG_CONFIG_HOME"); xdg != "" {
+			candidates = append(candidates, Candidate{filepath.Join(xdg, "Cursor", rel), "xdg-config"})
+		}
+		candidates = append(candidates, Candidate{filepath.Join(e.home, ".config/Cursor", rel), "home-config"})
+		for _, dir := range e.glob(filepath.Join(e.home, ".var/app/*/config/Cursor")) {
+			candidates = append(candidates, Candidate{filepath.Join(dir, rel), "flatpak"})
+		}
+		candidates = append(candidates, Candidate{filepath.Join(e.home, "snap/cursor/current/.config/Cursor", rel), "snap"})
+	}
+
+	return candidates
+}
+
+// packageJSONCandidates lists the places Cursor's resources/app/package.json may live.
+func (e searchEnv) packageJSONCandidates() []Candidate {
+	const rel = "resources/app/package.json"
+	var candidates []Candidate
+
+	switch e.goos {
+	case "darwin":
+		candidates = append(candidates,
+			Candidate{"/Applications/Cursor.app/Contents/Resources/app/package.json", "macos"},
+			Candidate{filepath.Join(e.home, "Applications/Cursor.app/Contents/Resources/app/package.json"), "macos-user"},
+		)
+	case "windows":
+		if local := e.getenv("LOCALAPPDATA"); local != "" {
+			candidates = append(candidates, Candidate{filepath.Join(local, "Programs/cursor", rel), "windows"})
+		}
+	default:
+		// Running from inside a mounted AppImage.
+		if appDir := e.getenv("APPDIR"); appDir != "" {
+			candidates = append(candidates,
+				Candidate{filepath.Join(appDir, "usr/share/cursor", rel), "appimage"},
+				Candidate{filepath.Join(appDir, rel), "appimage"},
+			)
+		}
+		candidates = append(candidates,
+			Candidate{filepath.Join("/usr/share/cursor", rel), "system"},
+			Candidate{filepath.Join("/opt/Cursor", rel), "system"},
+			Candidate{filepath.Join("/opt/cursor", rel), "system"},
+		)
+		// AppImages extracted with --appimage-extract into a squashfs-root.
+		for _, base := range []string{
+			filepath.Join(e.home, "Applications/cursor"),
+			filepath.Join(e.home, "Applications/Cursor"),
+			filepath.Join(e.home, "Applications/squashfs-root"),
+			filepath.Join(e.home, ".local/share/cursor"),
+			filepath.Join(e.home, "squashfs-root"),
+		} {
+			candidates = append(candidates,
+				Candidate{filepath.Join(base, "usr/share/cursor", rel), "appimage-extracted"},
+				Candidate{filepath.Join(base, rel), "appimage-extracted"},
+			)
+		}
+		for _, root := range []string{filepath.Join(e.home, ".local/share/flatpak/app"), "/var/lib/flatpak/app"} {
+			for _, dir := range e.glob(filepath.Join(root, "*", "current/active/files")) {
+				if !strings.Contains(strings.ToLower(dir), "cursor") {
+					continue
+				}
+				candidates = append(candidates,
+					Candidate{filepath.Join(dir, "extra", rel), "flatpak"},
+					Candidate{filepath.Join(dir, "share/cursor", rel), "flatpak"},
+				)
+			}
+		}
+		candidates = append(candidates, Candidate{filepath.Join("/snap/cursor/current/usr/share/cursor", rel), "snap"})
+	}
+
+	return candidates
+}
+
+func (e searchEnv) glob(pattern string) []string {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil
+	}
+	return matches
+}
+
+// firstExisting returns the first candidate that is a regular file.
+func firstExisting(what string, candidates []Candidate) (Candidate, error) {
+	tried := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if info, err := os.Stat(c.Path); err == nil && info.Mode().IsRegular() {
+			return c, nil
+		}
+		tried = append(tried, c.Path)
+	}
+	return Candidate{}, fmt.Errorf("no Cursor %s found (tried: %s)", what, strings.Join(tried, ", "))
+}
+
+// FindStateDB locates Cursor's state.vscdb credential database.
+func FindStateDB() (Candidate, error) {
+	return defaultSearchEnv().findStateDB()
+}
+
+// ExpectedStateDB returns the state.vscdb to watch for credentials: the existing one
+// or, if Cursor has not created it yet, the place it most likely will. It reports false
+// if there is no candidate location at all.
+func ExpectedStateDB() (Candidate, bool) {
+	return defaultSearchEnv().expectedStateDB()
+}
+
+// FindPackageJSON locates the package.json of the installed Cursor app.
+func FindPackageJSON() (Candidate, error) {
+	return defaultSearchEnv().findPackageJSON()
+}
+
+func (e searchEnv) findStateDB() (Candidate, error) {
+	return firstExisting("state.vscdb", e.stateDBCandidates())
+}
+
+func (e searchEnv) expectedStateDB() (Candidate, bool) {
+	candidates := e.stateDBCandidates()
+	if c, err := firstExisting("state.vscdb", candidates); err == nil {
+		return c, true
+	}
+	if len(candidates) == 0 {
+		return Candidate{}, false
+	}
+	return candidates[0], true
+}
+
+func (e searchEnv) findPackageJSON() (Candidate, error) {
+	return firstExisting("package.json", e.packageJSONCandidates())
+}
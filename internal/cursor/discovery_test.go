@@ -0,0 +1,268 @@
+package cursor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// touch creates path, and its parent directories, under root.
+func touch(t *testing.T, root, path string) string {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return full
+}
+
+func testEnv(goos, home string, env map[string]string) searchEnv {
+	return searchEnv{
+		goos:   goos,
+		home:   home,
+		getenv: func(key string) string { return env[key] },
+	}
+}
+
+func TestFindStateDB(t *testing.T) {
+	const rel = "User/globalStorage/state.vscdb"
+
+	tests := []struct {
+		name string
+		goos string
+		// files are created under the temporary home; env values are joined to it.
+		files      []string
+		env        map[string]string
+		wantPath   string
+		wantSource string
+	}{
+		{
+			name:       "linux home config",
+			goos:       "linux",
+			files:      []string{".config/Cursor/" + rel},
+			wantPath:   ".config/Cursor/" + rel,
+			wantSource: "home-config",
+		},
+		{
+			name:       "linux XDG_CONFIG_HOME wins",
+			goos:       "linux",
+			files:      []string{".config/Cursor/" + rel, "xdg/Cursor/" + rel},
+			env:        map[string]string{"XDG_CONFIG_HOME": "xdg"},
+			wantPath:   "xdg/Cursor/" + rel,
+			wantSource: "xdg-config",
+		},
+		{
+			name:       "linux missing XDG dir falls through",
+			goos:       "linux",
+			files:      []string{".config/Cursor/" + rel},
+			env:        map[string]string{"XDG_CONFIG_HOME": "missing"},
+			wantPath:   ".config/Cursor/" + rel,
+			wantSource: "home-config",
+		},
+		{
+			name:       "linux flatpak",
+			goos:       "linux",
+			files:      []string{".var/app/com.cursor.Cursor/config/Cursor/" + rel},
+			wantPath:   ".var/app/com.cursor.Cursor/config/Cursor/" + rel,
+			wantSource: "flatpak",
+		},
+		{
+			name:       "linux snap",
+			goos:       "linux",
+			files:      []string{"snap/cursor/current/.config/Cursor/" + rel},
+			wantPath:   "snap/cursor/current/.config/Cursor/" + rel,
+			wantSource: "snap",
+		},
+		{
+			name:       "macos",
+			goos:       "darwin",
+			files:      []string{"Library/Application Support/Cursor/" + rel},
+			wantPath:   "Library/Application Support/Cursor/" + rel,
+			wantSource: "macos",
+		},
+		{
+			name:       "windows appdata",
+			goos:       "windows",
+			files:      []string{"AppData/Roaming/Cursor/" + rel},
+			env:        map[string]string{"APPDATA": "AppData/Roaming"},
+			wantPath:   "AppData/Roaming/Cursor/" + rel,
+			wantSource: "appdata",
+		},
+		{
+			name:  "windows without APPDATA",
+			goos:  "windows",
+			files: []string{"AppData/Roaming/Cursor/" + rel},
+		},
+		{
+			name:  "nothing installed",
+			goos:  "linux",
+			files: []string{".config/Cursor/User/other.json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			for _, f := range tt.files {
+				touch(t, home, f)
+			}
+			env := make(map[string]string)
+			for k, v := range tt.env {
+				env[k] = filepath.Join(home, v)
+			}
+
+			got, err := testEnv(tt.goos, home, env).findStateDB()
+			if tt.wantPath == "" {
+				if err == nil {
+					t.Fatalf("found %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(home, tt.wantPath); got.Path != want || got.Source != tt.wantSource {
+				t.Errorf("found %s (%s), want %s (%s)", got.Path, got.Source, want, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestFindStateDBErrorListsCandidates(t *testing.T) {
+	home := t.TempDir()
+	_, err := testEnv("linux", home, nil).findStateDB()
+	if err == nil {
+		t.Fatal("want an error with no install")
+	}
+	if want := filepath.Join(home, ".config/Cursor"); !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not mention %s", err, want)
+	}
+}
+
+func TestFindStateDBSkipsDirectories(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".config/Cursor/User/globalStorage/state.vscdb"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := testEnv("linux", home, nil).findStateDB(); err == nil {
+		t.Errorf("found %+v, want a directory to be skipped", got)
+	}
+}
+
+func TestExpectedStateDB(t *testing.T) {
+	home := t.TempDir()
+	env := testEnv("linux", home, nil)
+
+	got, ok := env.expectedStateDB()
+	if want := filepath.Join(home, ".config/Cursor/User/globalStorage/state.vscdb"); !ok || got.Path != want {
+		t.Errorf("before install = %+v, %v, want %s", got, ok, want)
+	}
+
+	snap := touch(t, home, "snap/cursor/current/.config/Cursor/User/globalStorage/state.vscdb")
+	if got, ok := env.expectedStateDB(); !ok || got.Path != snap {
+		t.Errorf("after install = %+v, %v, want %s", got, ok, snap)
+	}
+
+	if got, ok := testEnv("windows", home, nil).expectedStateDB(); ok {
+		t.Errorf("windows without APPDATA = %+v, want none", got)
+	}
+}
+
+func TestFindPackageJSON(t *testing.T) {
+	const rel = "resources/app/package.json"
+
+	tests := []struct {
+		name       string
+		goos       string
+		files      []string
+		env        map[string]string
+		wantPath   string
+		wantSource string
+	}{
+		{
+			name:       "macos user applications",
+			goos:       "darwin",
+			files:      []string{"Applications/Cursor.app/Contents/Resources/app/package.json"},
+			wantPath:   "Applications/Cursor.app/Contents/Resources/app/package.json",
+			wantSource: "macos-user",
+		},
+		{
+			name:       "windows local appdata",
+			goos:       "windows",
+			files:      []string{"AppData/Local/Programs/cursor/" + rel},
+			env:        map[string]string{"LOCALAPPDATA": "AppData/Local"},
+			wantPath:   "AppData/Local/Programs/cursor/" + rel,
+			wantSource: "windows",
+		},
+		{
+			name:       "mounted AppImage",
+			goos:       "linux",
+			files:      []string{"mnt/usr/share/cursor/" + rel},
+			env:        map[string]string{"APPDIR": "mnt"},
+			wantPath:   "mnt/usr/share/cursor/" + rel,
+			wantSource: "appimage",
+		},
+		{
+			name:       "portable extracted AppImage",
+			goos:       "linux",
+			files:      []string{"squashfs-root/usr/share/cursor/" + rel},
+			wantPath:   "squashfs-root/usr/share/cursor/" + rel,
+			wantSource: "appimage-extracted",
+		},
+		{
+			name:       "portable install in Applications",
+			goos:       "linux",
+			files:      []string{"Applications/Cursor/" + rel},
+			wantPath:   "Applications/Cursor/" + rel,
+			wantSource: "appimage-extracted",
+		},
+		{
+			name:       "user flatpak",
+			goos:       "linux",
+			files:      []string{".local/share/flatpak/app/com.cursor.Cursor/current/active/files/extra/" + rel},
+			wantPath:   ".local/share/flatpak/app/com.cursor.Cursor/current/active/files/extra/" + rel,
+			wantSource: "flatpak",
+		},
+		{
+			name:  "flatpak of another app",
+			goos:  "linux",
+			files: []string{".local/share/flatpak/app/org.example.Editor/current/active/files/extra/" + rel},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			for _, f := range tt.files {
+				touch(t, home, f)
+			}
+			env := make(map[string]string)
+			for k, v := range tt.env {
+				env[k] = filepath.Join(home, v)
+			}
+
+			got, err := testEnv(tt.goos, home, env).findPackageJSON()
+			if tt.wantPath == "" {
+				// System-wide installs outside the temporary home may exist on the
+				// machine running the test; only a hit inside it is wrong.
+				if err == nil && strings.HasPrefix(got.Path, home) {
+					t.Fatalf("found %+v, want nothing under %s", got, home)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(got.Path, home) {
+				t.Skipf("system-wide Cursor install at %s is searched first", got.Path)
+			}
+			if want := filepath.Join(home, tt.wantPath); got.Path != want || got.Source != tt.wantSource {
+				t.Errorf("found %s (%s), want %s (%s)", got.Path, got.Source, want, tt.wantSource)
+			}
+		})
+	}
+}
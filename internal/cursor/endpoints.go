@@ -0,0 +1,155 @@
+package cursor
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+	"github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1/aiserverv1connect"
+)
+
+// failbackAfter is how long the client sticks with a fallback endpoint before trying
+// the primary again.
+const failbackAfter = 5 * time.Minute
+
+type endpoint struct {
+	baseURL  string
+	aiClient aiserverv1connect.AiServiceClient
+}
+
+// endpointSet is the primary API endpoint followed by its fallbacks, plus which one
+// is currently in use.
+type endpointSet struct {
+	endpoints []endpoint
+
+	mu           sync.Mutex
+	active       int
+	failedOverAt time.Time
+}
+
+func newEndpointSet(httpClient connect.HTTPClient, baseURLs []string) *endpointSet {
+	set := &endpointSet{}
+	for _, u := range baseURLs {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u == "" {
+			continue
+		}
+		set.endpoints = append(set.endpoints, endpoint{
+			baseURL:  u,
+			aiClient: aiserverv1connect.NewAiServiceClient(httpClient, u),
+		})
+	}
+	return set
+}
+
+// start returns the index to try first: the active endpoint, or the primary once a
+// failover has lasted long enough.
+func (s *endpointSet) start() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != 0 && time.Since(s.failedOverAt) > failbackAfter {
+		s.active = 0
+	}
+	return s.active
+}
+
+func (s *endpointSet) setActive(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i != s.active {
+		s.active = i
+		s.failedOverAt = time.Now()
+	}
+}
+
+func (s *endpointSet) activeURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endpoints[s.active].baseURL
+}
+
+func (s *endpointSet) urls() []string {
+	urls := make([]string, len(s.endpoints))
+	for i, e := range s.endpoints {
+		urls[i] = e.baseURL
+	}
+	return urls
+}
+
+// shouldFailover reports whether an error means the endpoint itself is unhealthy:
+// connection failures and 5xx responses, which Connect reports as these codes.
+func shouldFailover(err error) bool {
+	switch connect.CodeOf(err) {
+	case connect.CodeUnavailable, connect.CodeUnknown, connect.CodeInternal:
+		return true
+	}
+	return false
+}
+
+// streamCpp opens the stream on the active endpoint, moving on to the next one in
+// order when an endpoint is unreachable or failing.
+func (c *Client) streamCpp(ctx context.Context, req *aiserverv1.StreamCppRequest, creds *Credentials) (*Stream, error) {
+	start := c.endpoints.start()
+	n := len(c.endpoints.endpoints)
+
+	var err error
+	for i := 0; i < n; i++ {
+		idx := (start + i) % n
+		ep := c.endpoints.endpoints[idx]
+
+		var stream *Stream
+		stream, err = c.streamCppAt(ctx, ep, req, creds)
+		if err == nil {
+			if idx != start {
+				c.logger.Warn("Failed over to fallback Cursor API endpoint", "base_url", ep.baseURL)
+			}
+			c.endpoints.setActive(idx)
+			return stream, nil
+		}
+		if ctx.Err() != nil || !shouldFailover(err) {
+			return nil, err
+		}
+		if n > 1 {
+			c.logger.Warn("Cursor API endpoint failed", "base_url", ep.baseURL, "error", err)
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) streamCppAt(ctx context.Context, ep endpoint, req *aiserverv1.StreamCppRequest, creds *Credentials) (*Stream, error) {
+	connectReq := connect.NewRequest(req)
+	connectReq.Header().Set("authorization", "Bearer "+creds.AccessToken)
+	connectReq.Header().Set("x-cursor-client-version", c.clientVersion)
+	connectReq.Header().Set("x-cursor-machine-id", creds.MachineID)
+
+	c.lastUsed.Store(time.Now().UnixNano())
+	ctx, trace := withConnTrace(ctx)
+
+	var recorder *fixtureRecorder
+	if c.recordDir != "" {
+		recorder = newFixtureRecorder(c.recordDir, ep.baseURL, req, c.logger)
+	}
+
+	conn, err := ep.aiClient.StreamCpp(ctx, connectReq)
+	if err != nil {
+		if recorder != nil {
+			recorder.finish(err)
+		}
+		return nil, err
+	}
+
+	stream, err := openStream(conn, c.recordError, recorder)
+	if err != nil {
+		return nil, err
+	}
+
+	if setup, reused, ok := trace.connected(); ok {
+		firstChunk := time.Since(trace.start)
+		c.latency.record(setup, firstChunk, reused)
+		c.logger.Debug("StreamCpp latency", "base_url", ep.baseURL, "connect", setup, "first_chunk", firstChunk, "reused_conn", reused)
+	}
+	return stream, nil
+}
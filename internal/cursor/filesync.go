@@ -0,0 +1,122 @@
+package cursor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+)
+
+// filesyncState remembers, per document, the version the API was last sent, so later
+// requests can carry the edits since then instead of the whole file.
+type filesyncState struct {
+	mu       sync.Mutex
+	versions map[filesyncKey]int32
+	// rejections counts edits the API rejected since it last accepted any; at
+	// maxFilesyncRejections filesync is given up for the session.
+	rejections int
+}
+
+const maxFilesyncRejections = 3
+
+type filesyncKey struct {
+	workspace string
+	path      string
+}
+
+func newFilesyncState() *filesyncState {
+	return &filesyncState{versions: make(map[filesyncKey]int32)}
+}
+
+func (f *filesyncState) synced(doc *completion.Document) (int32, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rejections >= maxFilesyncRejections {
+		return 0, false
+	}
+	version, ok := f.versions[filesyncKey{doc.Workspace, doc.Path}]
+	return version, ok
+}
+
+// record notes that the API now has doc. incremental says it was sent as edits.
+func (f *filesyncState) record(doc *completion.Document, incremental bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.versions[filesyncKey{doc.Workspace, doc.Path}] = doc.Version
+	if incremental {
+		f.rejections = 0
+	}
+}
+
+// forget drops doc's synced version, so it is next sent in full.
+func (f *filesyncState) forget(doc *completion.Document) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.versions, filesyncKey{doc.Workspace, doc.Path})
+}
+
+// reject counts a request that failed with edits but succeeded with full contents,
+// and reports whether filesync has now been given up.
+func (f *filesyncState) reject() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rejections++
+	return f.rejections == maxFilesyncRejections
+}
+
+// applyFilesync marks req's file with its version and hash and, if the API already has
+// an earlier version whose changes are still known, replaces the contents with those
+// changes. It reports whether it did.
+func (f *filesyncState) applyFilesync(req *aiserverv1.StreamCppRequest, doc *completion.Document) bool {
+	file := req.CurrentFile
+	version := doc.Version
+	hash := sha256.Sum256([]byte(doc.Contents))
+	hexHash := hex.EncodeToString(hash[:])
+	file.FileVersion = &version
+	file.Sha_256Hash = &hexHash
+
+	synced, ok := f.synced(doc)
+	if !ok {
+		return false
+	}
+	changes, ok := doc.ChangesSince(synced)
+	if !ok {
+		return false
+	}
+
+	req.FilesyncUpdates = filesyncUpdates(doc.Path, changes)
+	file.RelyOnFilesync = true
+	file.Contents = ""
+	return true
+}
+
+// filesyncUpdates groups changes into one update per version. Offsets, lengths and
+// columns are in UTF-16 code units, which is how the API's VS Code lineage counts.
+func filesyncUpdates(path string, changes []completion.DocumentChange) []*aiserverv1.FilesyncUpdateWithModelVersion {
+	var updates []*aiserverv1.FilesyncUpdateWithModelVersion
+	for _, change := range changes {
+		if len(updates) == 0 || updates[len(updates)-1].ModelVersion != change.Version {
+			updates = append(updates, &aiserverv1.FilesyncUpdateWithModelVersion{
+				ModelVersion:          change.Version,
+				RelativeWorkspacePath: path,
+			})
+		}
+		update := updates[len(updates)-1]
+		update.Updates = append(update.Updates, &aiserverv1.SingleUpdateRequest{
+			StartPosition:  int32(change.UTF16.Start),
+			EndPosition:    int32(change.UTF16.End),
+			ChangeLength:   int32(change.UTF16.End - change.UTF16.Start),
+			ReplacedString: change.Text,
+			Range: &aiserverv1.SimpleRange{
+				StartLineNumber:        change.StartPos.Line + 1,
+				StartColumn:            int32(change.UTF16.StartColumn) + 1,
+				EndLineNumberInclusive: change.EndPos.Line + 1,
+				EndColumn:              int32(change.UTF16.EndColumn) + 1,
+			},
+		})
+		update.ExpectedFileLength = int32(change.UTF16.Length)
+	}
+	return updates
+}
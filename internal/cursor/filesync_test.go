@@ -0,0 +1,62 @@
+package cursor_test
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor/cursortest"
+)
+
+func complete(t *testing.T, client *cursor.Client, doc *completion.Document) {
+	t.Helper()
+	stream, err := client.Complete(context.Background(), &completion.Request{
+		WorkspacePath: doc.Workspace,
+		FilePath:      doc.Path,
+		FileContents:  doc.Contents,
+		Document:      doc,
+	})
+	if err != nil {
+		t.Fatalf("completing version %d: %v", doc.Version, err)
+	}
+	for stream.Receive() {
+	}
+	stream.Close()
+}
+
+func TestFilesyncFallsBackOnAnyError(t *testing.T) {
+	ok := cursortest.Script(cursortest.Edit(1, 1, "x"), cursortest.DoneStream())
+	upstream := cursortest.NewServer(t, ok, cursortest.Script(cursortest.Error(connect.CodeInternal, "boom")), ok)
+	client := upstream.Client(t, cursor.Options{Filesync: true, Retry: cursor.RetryPolicy{MaxAttempts: 1}})
+
+	v1 := &completion.Document{Workspace: "/work", Path: "main.go", Version: 1, Contents: "é\n", ChangesFrom: 1}
+	complete(t, client, v1)
+
+	v2 := &completion.Document{
+		Workspace: "/work", Path: "main.go", Version: 2, Contents: "éb\n", ChangesFrom: 1,
+		Changes: []completion.DocumentChange{{
+			Version: 2, Start: 2, End: 2, Text: "b", Length: 4,
+			StartPos: completion.Position{Column: 2}, EndPos: completion.Position{Column: 2},
+			UTF16: completion.UTF16Offsets{Start: 1, End: 1, StartColumn: 1, EndColumn: 1, Length: 3},
+		}},
+	}
+	complete(t, client, v2)
+
+	calls := upstream.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want the full request, the failed edits and the full resend", len(calls))
+	}
+	updates := calls[1].Request.FilesyncUpdates
+	if !calls[1].Request.CurrentFile.RelyOnFilesync || len(updates) != 1 || len(updates[0].Updates) != 1 {
+		t.Fatalf("second call = %+v, want edits", calls[1].Request)
+	}
+	// The API counts in UTF-16 code units, in which "é" is one long, not two.
+	if update := updates[0].Updates[0]; update.StartPosition != 1 || update.Range.StartColumn != 2 || updates[0].ExpectedFileLength != 3 {
+		t.Errorf("update = %+v, expected length %d, want UTF-16 offsets", update, updates[0].ExpectedFileLength)
+	}
+	if file := calls[2].Request.CurrentFile; file.RelyOnFilesync || file.Contents != v2.Contents {
+		t.Errorf("resent file = %+v, want the full contents", file)
+	}
+}
@@ -0,0 +1,176 @@
+package cursor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Fixture is one recorded StreamCpp call: the request, every response chunk with the
+// time it arrived, and the error that ended the stream, if any. Messages are stored
+// as protojson so fixtures can be read and edited by hand.
+type Fixture struct {
+	RecordedAt time.Time       `json:"recorded_at"`
+	BaseURL    string          `json:"base_url,omitempty"`
+	Request    json.RawMessage `json:"request"`
+	Chunks     []FixtureChunk  `json:"chunks"`
+	Error      *FixtureError   `json:"error,omitempty"`
+
+	path string
+}
+
+type FixtureChunk struct {
+	// OffsetMs is when the chunk arrived, relative to the start of the call.
+	OffsetMs int64           `json:"offset_ms"`
+	Response json.RawMessage `json:"response"`
+}
+
+type FixtureError struct {
+	// Code is a Connect code name such as "unavailable".
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Path is the file the fixture was loaded from.
+func (f *Fixture) Path() string {
+	return f.path
+}
+
+// StreamCppRequest decodes the recorded request.
+func (f *Fixture) StreamCppRequest() (*aiserverv1.StreamCppRequest, error) {
+	req := &aiserverv1.StreamCppRequest{}
+	if len(f.Request) == 0 {
+		return req, nil
+	}
+	if err := protojson.Unmarshal(f.Request, req); err != nil {
+		return nil, fmt.Errorf("error decoding request in %s: %w", f.path, err)
+	}
+	return req, nil
+}
+
+// Responses decodes the recorded chunks.
+func (f *Fixture) Responses() ([]*aiserverv1.StreamCppResponse, error) {
+	responses := make([]*aiserverv1.StreamCppResponse, len(f.Chunks))
+	for i, chunk := range f.Chunks {
+		responses[i] = &aiserverv1.StreamCppResponse{}
+		if err := protojson.Unmarshal(chunk.Response, responses[i]); err != nil {
+			return nil, fmt.Errorf("error decoding chunk %d in %s: %w", i, f.path, err)
+		}
+	}
+	return responses, nil
+}
+
+// ConnectError returns the recorded error as a Connect error, or nil.
+func (f *Fixture) ConnectError() error {
+	if f.Error == nil {
+		return nil
+	}
+	var code connect.Code
+	if err := code.UnmarshalText([]byte(f.Error.Code)); err != nil {
+		code = connect.CodeUnknown
+	}
+	return connect.NewError(code, errors.New(f.Error.Message))
+}
+
+// LoadFixtures reads every *.json fixture in dir, in file name order.
+func LoadFixtures(dir string) ([]*Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	fixtures := make([]*Fixture, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading fixture: %w", err)
+		}
+		f := &Fixture{path: path}
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, fmt.Errorf("error parsing fixture %s: %w", path, err)
+		}
+		fixtures = append(fixtures, f)
+	}
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("no fixtures found in %s", dir)
+	}
+	return fixtures, nil
+}
+
+// fixtureRecorder captures one call as it streams and writes it out when it ends.
+type fixtureRecorder struct {
+	dir    string
+	logger *slog.Logger
+	start  time.Time
+
+	mu      sync.Mutex
+	fixture Fixture
+	written bool
+}
+
+func newFixtureRecorder(dir, baseURL string, req *aiserverv1.StreamCppRequest, logger *slog.Logger) *fixtureRecorder {
+	r := &fixtureRecorder{dir: dir, logger: logger, start: time.Now()}
+	r.fixture = Fixture{RecordedAt: r.start, BaseURL: baseURL}
+	if data, err := protojson.Marshal(req); err == nil {
+		r.fixture.Request = data
+	}
+	return r
+}
+
+func (r *fixtureRecorder) chunk(resp *aiserverv1.StreamCppResponse) {
+	data, err := protojson.Marshal(resp)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fixture.Chunks = append(r.fixture.Chunks, FixtureChunk{
+		OffsetMs: time.Since(r.start).Milliseconds(),
+		Response: data,
+	})
+}
+
+// finish writes the fixture once; later calls are ignored.
+func (r *fixtureRecorder) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.written {
+		return
+	}
+	r.written = true
+
+	if err != nil {
+		message := err.Error()
+		var connectErr *connect.Error
+		if errors.As(err, &connectErr) {
+			message = connectErr.Message()
+		}
+		r.fixture.Error = &FixtureError{Code: connect.CodeOf(err).String(), Message: message}
+	}
+
+	data, marshalErr := json.MarshalIndent(r.fixture, "", "  ")
+	if marshalErr != nil {
+		r.logger.Error("Failed to encode StreamCpp fixture", "error", marshalErr)
+		return
+	}
+	name := r.start.UTC().Format("20060102T150405.000") + "-" + strings.SplitN(uuid.New().String(), "-", 2)[0] + ".json"
+	path := filepath.Join(r.dir, name)
+	if writeErr := os.WriteFile(path, data, 0644); writeErr != nil {
+		r.logger.Error("Failed to write StreamCpp fixture", "error", writeErr)
+		return
+	}
+	r.logger.Debug("Recorded StreamCpp fixture", "path", path, "chunks", len(r.fixture.Chunks))
+}
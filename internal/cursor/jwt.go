@@ -0,0 +1,61 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TokenClaims are the registered claims of a Cursor access token. The token is only
+// decoded, not verified; the API does the verification.
+type TokenClaims struct {
+	Subject   string    `json:"sub"`
+	Issuer    string    `json:"iss,omitempty"`
+	ExpiresAt time.Time `json:"exp"`
+	IssuedAt  time.Time `json:"iat"`
+}
+
+// ParseTokenClaims decodes the payload of a JWT.
+func ParseTokenClaims(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("access token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding token payload: %w", err)
+	}
+
+	var raw struct {
+		Sub string  `json:"sub"`
+		Iss string  `json:"iss"`
+		Exp float64 `json:"exp"`
+		Iat float64 `json:"iat"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing token payload: %w", err)
+	}
+
+	claims := &TokenClaims{Subject: raw.Sub, Issuer: raw.Iss}
+	if raw.Exp > 0 {
+		claims.ExpiresAt = time.Unix(int64(raw.Exp), 0)
+	}
+	if raw.Iat > 0 {
+		claims.IssuedAt = time.Unix(int64(raw.Iat), 0)
+	}
+	return claims, nil
+}
+
+// expiresWithin reports whether the token expires within d. Tokens without a
+// readable expiry are treated as never expiring.
+func expiresWithin(token string, d time.Duration) bool {
+	claims, err := ParseTokenClaims(token)
+	if err != nil || claims.ExpiresAt.IsZero() {
+		return false
+	}
+	return time.Until(claims.ExpiresAt) < d
+}
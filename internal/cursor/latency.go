@@ -0,0 +1,107 @@
+package cursor
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// connTrace records when one request got its connection, so connection setup can be
+// told apart from the time the API takes to produce the first chunk.
+type connTrace struct {
+	start time.Time
+
+	mu      sync.Mutex
+	gotConn time.Time
+	reused  bool
+}
+
+func withConnTrace(ctx context.Context) (context.Context, *connTrace) {
+	t := &connTrace{start: time.Now()}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.gotConn.IsZero() {
+				t.gotConn = time.Now()
+				t.reused = info.Reused
+			}
+		},
+	}), t
+}
+
+// connected returns how long it took to get a connection and whether it was reused
+// from the pool. ok is false if the request never got one.
+func (t *connTrace) connected() (setup time.Duration, reused, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.gotConn.IsZero() {
+		return 0, false, false
+	}
+	return t.gotConn.Sub(t.start), t.reused, true
+}
+
+// LatencyStatus summarizes StreamCpp latency, split by whether the request had to
+// set up a new connection (cold) or reused a pooled one (warm).
+type LatencyStatus struct {
+	Requests          int    `json:"requests"`
+	ColdRequests      int    `json:"cold_requests"`
+	AvgConnectCold    string `json:"avg_connect_cold,omitempty"`
+	AvgFirstChunkCold string `json:"avg_first_chunk_cold,omitempty"`
+	AvgFirstChunkWarm string `json:"avg_first_chunk_warm,omitempty"`
+	LastConnect       string `json:"last_connect,omitempty"`
+	LastFirstChunk    string `json:"last_first_chunk,omitempty"`
+}
+
+type latencyStats struct {
+	mu             sync.Mutex
+	requests       int
+	cold           int
+	connectCold    time.Duration
+	firstChunkCold time.Duration
+	firstChunkWarm time.Duration
+	lastConnect    time.Duration
+	lastFirstChunk time.Duration
+}
+
+func (s *latencyStats) record(setup, firstChunk time.Duration, reused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if reused {
+		s.firstChunkWarm += firstChunk
+	} else {
+		s.cold++
+		s.connectCold += setup
+		s.firstChunkCold += firstChunk
+	}
+	s.lastConnect = setup
+	s.lastFirstChunk = firstChunk
+}
+
+func (s *latencyStats) status() LatencyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	avg := func(total time.Duration, n int) string {
+		if n == 0 {
+			return ""
+		}
+		return (total / time.Duration(n)).Round(time.Millisecond).String()
+	}
+
+	status := LatencyStatus{
+		Requests:          s.requests,
+		ColdRequests:      s.cold,
+		AvgConnectCold:    avg(s.connectCold, s.cold),
+		AvgFirstChunkCold: avg(s.firstChunkCold, s.cold),
+		AvgFirstChunkWarm: avg(s.firstChunkWarm, s.requests-s.cold),
+	}
+	if s.requests > 0 {
+		status.LastConnect = s.lastConnect.Round(time.Millisecond).String()
+		status.LastFirstChunk = s.lastFirstChunk.Round(time.Millisecond).String()
+	}
+	return status
+}
@@ -0,0 +1,157 @@
+package cursor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	managerMinBackoff = time.Second
+	managerMaxBackoff = time.Minute
+	// managerOnDemandInterval limits how often requests may trigger an extra attempt.
+	managerOnDemandInterval = time.Second
+)
+
+type ManagerState string
+
+const (
+	ManagerInitializing ManagerState = "initializing"
+	ManagerReady        ManagerState = "ready"
+	ManagerFailed       ManagerState = "failed"
+)
+
+// ManagerStatus is a snapshot of a Manager for status reporting.
+type ManagerStatus struct {
+	State       ManagerState `json:"state"`
+	Attempts    int          `json:"attempts"`
+	LastError   string       `json:"last_error,omitempty"`
+	LastAttempt *time.Time   `json:"last_attempt,omitempty"`
+	NextAttempt *time.Time   `json:"next_attempt,omitempty"`
+}
+
+// Manager owns the Cursor client. Creating a client fails until the user is signed in
+// to Cursor, so the manager keeps retrying with backoff in the background and also
+// retries on demand when a request needs a client.
+type Manager struct {
+	opts    Options
+	onReady func(*Client)
+
+	// initMu serializes attempts; mu guards the fields below it.
+	initMu      sync.Mutex
+	mu          sync.Mutex
+	client      *Client
+	attempts    int
+	lastErr     error
+	lastAttempt time.Time
+	nextAttempt time.Time
+}
+
+// NewManager returns a manager that creates clients with opts. onReady, if set, is
+// called once with the client when it is first created.
+func NewManager(opts Options, onReady func(*Client)) *Manager {
+	return &Manager{opts: opts, onReady: onReady}
+}
+
+// Start retries client creation with exponential backoff until it succeeds or ctx is done.
+func (m *Manager) Start(ctx context.Context) {
+	backoff := managerMinBackoff
+	for {
+		if _, err := m.attempt(); err == nil {
+			return
+		}
+
+		m.mu.Lock()
+		m.nextAttempt = time.Now().Add(backoff)
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > managerMaxBackoff {
+			backoff = managerMaxBackoff
+		}
+	}
+}
+
+// Client returns the client, making an immediate attempt to create it if there is none
+// yet and the last attempt was not too recent.
+func (m *Manager) Client() (*Client, error) {
+	m.mu.Lock()
+	client, lastErr, lastAttempt := m.client, m.lastErr, m.lastAttempt
+	m.mu.Unlock()
+
+	if client != nil {
+		return client, nil
+	}
+	if time.Since(lastAttempt) < managerOnDemandInterval && lastErr != nil {
+		return nil, lastErr
+	}
+
+	return m.attempt()
+}
+
+func (m *Manager) attempt() (*Client, error) {
+	m.initMu.Lock()
+	defer m.initMu.Unlock()
+
+	// Another caller may have succeeded while this one waited.
+	m.mu.Lock()
+	if m.client != nil {
+		client := m.client
+		m.mu.Unlock()
+		return client, nil
+	}
+	m.attempts++
+	attempts := m.attempts
+	m.lastAttempt = time.Now()
+	m.mu.Unlock()
+
+	client, err := NewClient(m.opts)
+
+	m.mu.Lock()
+	m.client, m.lastErr = client, err
+	m.nextAttempt = time.Time{}
+	m.mu.Unlock()
+
+	if err != nil {
+		if m.opts.Logger != nil {
+			m.opts.Logger.Warn("Failed to initialize Cursor client", "error", err, "attempt", attempts)
+		}
+		return nil, err
+	}
+
+	if m.opts.Logger != nil {
+		m.opts.Logger.Info("Cursor client initialized", "credential_source", client.CredentialSource(), "attempt", attempts)
+	}
+	if m.onReady != nil {
+		m.onReady(client)
+	}
+	return client, nil
+}
+
+// Status reports whether the client exists and, if not, why.
+func (m *Manager) Status() ManagerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := ManagerStatus{
+		Attempts:    m.attempts,
+		LastAttempt: optionalTime(m.lastAttempt),
+		NextAttempt: optionalTime(m.nextAttempt),
+	}
+	switch {
+	case m.client != nil:
+		status.State = ManagerReady
+	case m.lastErr != nil:
+		status.State = ManagerFailed
+		status.LastError = m.lastErr.Error()
+	default:
+		status.State = ManagerInitializing
+	}
+	return status
+}
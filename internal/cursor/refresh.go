@@ -0,0 +1,139 @@
+package cursor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultAuthEndpoint is where Cursor exchanges a refresh token for a new access token.
+	DefaultAuthEndpoint = "https://api2.cursor.sh/oauth/token"
+	// DefaultAuthClientID is the OAuth client ID of the Cursor desktop app.
+	DefaultAuthClientID = "KbZUR41cY7W6zRSdpSUJ7I7mLYBKOCmB"
+	// DefaultRefreshBefore is how long before expiry an access token is renewed.
+	DefaultRefreshBefore = 5 * time.Minute
+
+	refreshTimeout = 10 * time.Second
+)
+
+// currentCredentials returns the credentials to use for a request, renewing the access
+// token first if it is about to expire. If renewal fails the current token is used
+// anyway and the API gets to decide.
+func (c *Client) currentCredentials(ctx context.Context) *Credentials {
+	creds := c.credentials.Load()
+	if !expiresWithin(creds.AccessToken, c.refreshBefore) {
+		return creds
+	}
+
+	fresh, err := c.refresh(ctx, creds)
+	if err != nil {
+		c.logger.Warn("Failed to refresh expiring Cursor access token", "error", err, "source", creds.Source)
+		return creds
+	}
+	return fresh
+}
+
+// refresh replaces stale credentials, first by re-reading the credential provider and
+// then by exchanging the refresh token. It is safe to call from concurrent requests:
+// callers that lose the race get whatever the winner installed.
+func (c *Client) refresh(ctx context.Context, stale *Credentials) (*Credentials, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if current := c.credentials.Load(); current.AccessToken != stale.AccessToken {
+		return current, nil
+	}
+
+	// Cursor renews its own token while it is running, so re-reading is often enough.
+	refreshToken := stale.RefreshToken
+	reread, err := c.provider.Credentials()
+	if err == nil {
+		if reread.AccessToken != stale.AccessToken && !expiresWithin(reread.AccessToken, 0) {
+			c.swapCredentials(reread, "reloaded")
+			return reread, nil
+		}
+		if reread.RefreshToken != "" {
+			refreshToken = reread.RefreshToken
+		}
+	}
+
+	if refreshToken == "" {
+		return nil, errors.New("access token expired and no refresh token is available")
+	}
+
+	token, err := c.exchangeRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	fresh := *stale
+	fresh.AccessToken = token
+	fresh.RefreshToken = refreshToken
+	c.swapCredentials(&fresh, "refreshed")
+	return &fresh, nil
+}
+
+// swapCredentials atomically installs new credentials for subsequent requests. A
+// machine ID the new credentials lack is kept from the current ones.
+func (c *Client) swapCredentials(creds *Credentials, reason string) {
+	if creds.MachineID == "" {
+		creds.MachineID = c.credentials.Load().MachineID
+	}
+	c.credentials.Store(creds)
+
+	attrs := []any{"reason", reason, "source", creds.Source}
+	if claims, err := ParseTokenClaims(creds.AccessToken); err == nil && !claims.ExpiresAt.IsZero() {
+		attrs = append(attrs, "expires_at", claims.ExpiresAt)
+	}
+	c.logger.Info("Cursor credentials updated", attrs...)
+}
+
+func (c *Client) exchangeRefreshToken(ctx context.Context, refreshToken string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{
+		"grant_type":    "refresh_token",
+		"client_id":     c.authClientID,
+		"refresh_token": refreshToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.authEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling auth endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("auth endpoint returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var out struct {
+		AccessToken  string `json:"access_token"`
+		ShouldLogout bool   `json:"shouldLogout"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding auth response: %w", err)
+	}
+	if out.ShouldLogout || out.AccessToken == "" {
+		return "", errors.New("refresh token was rejected, sign in to Cursor again")
+	}
+
+	return out.AccessToken, nil
+}
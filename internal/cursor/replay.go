@@ -0,0 +1,194 @@
+package cursor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+	"github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1/aiserverv1connect"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReplayHandler is an AiService that answers StreamCpp from recorded fixtures,
+// reproducing their chunk timing. A request is matched to the fixture recorded for
+// an identical request, or failing that for the same file and cursor position.
+type ReplayHandler struct {
+	aiserverv1connect.UnimplementedAiServiceHandler
+
+	// Cycle answers requests that match no fixture with the fixtures in turn instead
+	// of failing, for scripted fixtures written without a particular request in mind.
+	Cycle bool
+	next  atomic.Uint64
+
+	fixtures   []*Fixture
+	byRequest  map[string]*Fixture
+	byPosition map[string]*Fixture
+}
+
+func NewReplayHandler(fixtures []*Fixture) (*ReplayHandler, error) {
+	h := &ReplayHandler{
+		fixtures:   fixtures,
+		byRequest:  make(map[string]*Fixture),
+		byPosition: make(map[string]*Fixture),
+	}
+	for _, f := range fixtures {
+		req, err := f.StreamCppRequest()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Responses(); err != nil {
+			return nil, err
+		}
+		h.byRequest[requestKey(req)] = f
+		h.byPosition[positionKey(req)] = f
+	}
+	return h, nil
+}
+
+func requestKey(req *aiserverv1.StreamCppRequest) string {
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func positionKey(req *aiserverv1.StreamCppRequest) string {
+	file := req.GetCurrentFile()
+	pos := file.GetCursorPosition()
+	return fmt.Sprintf("%s:%d:%d", file.GetRelativeWorkspacePath(), pos.GetLine(), pos.GetColumn())
+}
+
+func (h *ReplayHandler) match(req *aiserverv1.StreamCppRequest) *Fixture {
+	if f := h.byRequest[requestKey(req)]; f != nil {
+		return f
+	}
+	if f := h.byPosition[positionKey(req)]; f != nil || !h.Cycle {
+		return f
+	}
+	i := h.next.Add(1) - 1
+	return h.fixtures[i%uint64(len(h.fixtures))]
+}
+
+// StreamCpp implements aiserverv1connect.AiServiceHandler.
+func (h *ReplayHandler) StreamCpp(ctx context.Context, req *connect.Request[aiserverv1.StreamCppRequest], stream *connect.ServerStream[aiserverv1.StreamCppResponse]) error {
+	f := h.match(req.Msg)
+	if f == nil {
+		return connect.NewError(connect.CodeNotFound, errors.New("no recorded fixture matches this request"))
+	}
+	return ServeFixture(ctx, f, stream)
+}
+
+// ServeFixture sends a fixture's chunks at their recorded offsets and then its error.
+func ServeFixture(ctx context.Context, f *Fixture, stream *connect.ServerStream[aiserverv1.StreamCppResponse]) error {
+	responses, err := f.Responses()
+	if err != nil {
+		return connect.NewError(connect.CodeInternal, err)
+	}
+
+	start := time.Now()
+	for i, resp := range responses {
+		wait := time.Duration(f.Chunks[i].OffsetMs)*time.Millisecond - time.Since(start)
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return f.ConnectError()
+}
+
+// handlerTransport is an http.RoundTripper that serves requests with an in-process
+// handler, streaming the response body through a pipe. It lets a Connect client talk
+// to a local AiService without opening a socket.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func newReplayHandler(dir string) (*ReplayHandler, error) {
+	fixtures, err := LoadFixtures(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayHandler(fixtures)
+}
+
+func newHandlerTransport(service aiserverv1connect.AiServiceHandler) *handlerTransport {
+	mux := http.NewServeMux()
+	mux.Handle(aiserverv1connect.NewAiServiceHandler(service))
+	return &handlerTransport{handler: mux}
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, pipe := io.Pipe()
+	w := &pipeResponseWriter{header: make(http.Header), pipe: pipe, ready: make(chan struct{})}
+
+	go func() {
+		defer func() {
+			w.WriteHeader(http.StatusOK)
+			pipe.Close()
+		}()
+		t.handler.ServeHTTP(w, req)
+	}()
+
+	select {
+	case <-w.ready:
+	case <-req.Context().Done():
+		body.CloseWithError(req.Context().Err())
+		return nil, req.Context().Err()
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sent,
+		Body:          body,
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+type pipeResponseWriter struct {
+	header http.Header
+	pipe   *io.PipeWriter
+
+	once   sync.Once
+	ready  chan struct{}
+	status int
+	sent   http.Header
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	w.once.Do(func() {
+		w.status = status
+		w.sent = w.header.Clone()
+		close(w.ready)
+	})
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.pipe.Write(p)
+}
+
+// Flush is a no-op: writes reach the reader as soon as they are made.
+func (w *pipeResponseWriter) Flush() {}
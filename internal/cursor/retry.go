@@ -0,0 +1,87 @@
+package cursor
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"syscall"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// RetryPolicy controls how StreamCpp retries failures that happen before the first
+// response message. Once a message has been returned to the caller nothing is retried.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt; 1 disables retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of each backoff that is randomized, between 0 and 1.
+	Jitter float64
+}
+
+// DefaultRetryPolicy keeps retries short: a tab completion that arrives after the
+// user has typed on is useless.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     500 * time.Millisecond,
+	Multiplier:     2,
+	Jitter:         0.5,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p == (RetryPolicy{}) {
+		return DefaultRetryPolicy
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		p.Jitter = DefaultRetryPolicy.Jitter
+	}
+	return p
+}
+
+// backoff returns the delay before retry number n (1 for the first retry).
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < n; i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// isRetryable classifies a failure to open the stream. Only transient transport-level
+// failures qualify; anything the API decided on purpose (bad request, auth, rate
+// limits) is returned as is.
+func isRetryable(err error) bool {
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) && transportErr.Kind == TransportErrorTLS {
+		// A certificate that fails verification will fail again.
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	switch connect.CodeOf(err) {
+	case connect.CodeUnavailable, connect.CodeAborted, connect.CodeDeadlineExceeded:
+		return true
+	}
+	return false
+}
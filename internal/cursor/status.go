@@ -0,0 +1,107 @@
+package cursor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// Status describes the client's credentials and upstream health. It never includes
+// the access token itself.
+type Status struct {
+	CredentialSource string         `json:"credential_source"`
+	Token            *TokenStatus   `json:"token,omitempty"`
+	TokenError       string         `json:"token_error,omitempty"`
+	ClientVersion    string         `json:"client_version"`
+	MachineIDPresent bool           `json:"machine_id_present"`
+	BaseURL          string         `json:"base_url"`
+	Endpoints        []string       `json:"endpoints"`
+	LastError        *UpstreamError `json:"last_error,omitempty"`
+	Breaker          BreakerStatus  `json:"breaker"`
+	Latency          LatencyStatus  `json:"latency"`
+	RecordDir        string         `json:"record_dir,omitempty"`
+	ReplayDir        string         `json:"replay_dir,omitempty"`
+	InProcess        bool           `json:"in_process,omitempty"`
+}
+
+// TokenStatus is the decoded, non-secret part of the access token.
+type TokenStatus struct {
+	Subject   string     `json:"subject"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn string     `json:"expires_in,omitempty"`
+	Expired   bool       `json:"expired"`
+}
+
+// UpstreamError is the most recent failure talking to the Cursor API. Transport is
+// set when the API could not be reached at all, to the TransportError kind.
+type UpstreamError struct {
+	Message   string    `json:"message"`
+	Code      string    `json:"code,omitempty"`
+	Transport string    `json:"transport,omitempty"`
+	Proxy     string    `json:"proxy,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Status reports the client's current state.
+func (c *Client) Status() Status {
+	creds := c.credentials.Load()
+	status := Status{
+		CredentialSource: creds.Source,
+		ClientVersion:    c.clientVersion,
+		MachineIDPresent: creds.MachineID != "",
+		BaseURL:          c.endpoints.activeURL(),
+		Endpoints:        c.endpoints.urls(),
+		LastError:        c.lastErr.Load(),
+		Breaker:          c.breaker.status(),
+		Latency:          c.latency.status(),
+		RecordDir:        c.recordDir,
+		ReplayDir:        c.replayDir,
+		InProcess:        c.inProcess,
+	}
+
+	claims, err := ParseTokenClaims(creds.AccessToken)
+	if err != nil {
+		status.TokenError = err.Error()
+		return status
+	}
+
+	status.Token = &TokenStatus{Subject: claims.Subject}
+	if !claims.ExpiresAt.IsZero() {
+		remaining := time.Until(claims.ExpiresAt)
+		status.Token.ExpiresAt = &claims.ExpiresAt
+		status.Token.ExpiresIn = remaining.Round(time.Second).String()
+		status.Token.Expired = remaining <= 0
+	}
+	return status
+}
+
+// optionalTime returns nil for the zero time, which omitempty does not leave out of
+// JSON as a time.Time.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// recordError remembers an upstream failure for Status. Cancellations by the caller
+// are not upstream failures and are ignored.
+func (c *Client) recordError(err error) {
+	if err == nil || errors.Is(err, context.Canceled) || connect.CodeOf(err) == connect.CodeCanceled {
+		return
+	}
+
+	upstreamErr := &UpstreamError{Message: err.Error(), At: time.Now()}
+	var connectErr *connect.Error
+	if errors.As(err, &connectErr) {
+		upstreamErr.Code = connectErr.Code().String()
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		upstreamErr.Transport = transportErr.Kind
+		upstreamErr.Proxy = transportErr.Proxy
+	}
+	c.lastErr.Store(upstreamErr)
+}
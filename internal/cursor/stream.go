@@ -0,0 +1,84 @@
+package cursor
+
+import (
+	"connectrpc.com/connect"
+	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+)
+
+// Stream is a StreamCpp response stream. Its first message has already been received
+// when StreamCpp returns, so call-level failures such as a rejected token are reported
+// by StreamCpp itself rather than by the first Receive.
+type Stream struct {
+	conn    *connect.ServerStreamForClient[aiserverv1.StreamCppResponse]
+	pending *aiserverv1.StreamCppResponse
+	msg     *aiserverv1.StreamCppResponse
+	onError func(error)
+	// recorder, if set, captures the call as a fixture.
+	recorder *fixtureRecorder
+}
+
+// openStream waits for the first response message. onError is called if the stream
+// later ends with an error.
+func openStream(conn *connect.ServerStreamForClient[aiserverv1.StreamCppResponse], onError func(error), recorder *fixtureRecorder) (*Stream, error) {
+	s := &Stream{conn: conn, onError: onError, recorder: recorder}
+	if conn.Receive() {
+		s.pending = conn.Msg()
+		s.record(s.pending)
+		return s, nil
+	}
+	err := conn.Err()
+	s.finish(err)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Stream) record(msg *aiserverv1.StreamCppResponse) {
+	if s.recorder != nil {
+		s.recorder.chunk(msg)
+	}
+}
+
+func (s *Stream) finish(err error) {
+	if s.recorder != nil {
+		s.recorder.finish(err)
+	}
+}
+
+// Receive advances to the next message, returning false at the end of the stream or on error.
+func (s *Stream) Receive() bool {
+	if s.pending != nil {
+		s.msg, s.pending = s.pending, nil
+		return true
+	}
+	if !s.conn.Receive() {
+		err := s.conn.Err()
+		s.finish(err)
+		if err != nil && s.onError != nil {
+			s.onError(err)
+		}
+		return false
+	}
+	s.msg = s.conn.Msg()
+	s.record(s.msg)
+	return true
+}
+
+// Msg returns the message read by the last successful Receive.
+func (s *Stream) Msg() *aiserverv1.StreamCppResponse {
+	return s.msg
+}
+
+// Err returns the error that ended the stream, if any.
+func (s *Stream) Err() error {
+	return s.conn.Err()
+}
+
+// Close releases the underlying connection. A stream being recorded is written out
+// with the chunks received so far.
+func (s *Stream) Close() error {
+	s.finish(nil)
+	return s.conn.Close()
+}
@@ -0,0 +1,102 @@
+#!/usr/bin/env python3
+"""Regenerates the state.vscdb fixtures read by vscdb_test.go.
+
+Run from this directory: python3 gen_vscdb.py
+"""
+
+import os
+import shutil
+import sqlite3
+
+SCHEMA = "CREATE TABLE ItemTable (key TEXT UNIQUE ON CONFLICT REPLACE, value BLOB)"
+
+
+def connect(path, journal_mode):
+    for suffix in ("", "-wal", "-shm", "-journal"):
+        if os.path.exists(path + suffix):
+            os.remove(path + suffix)
+    conn = sqlite3.connect(path, isolation_level=None)
+    conn.execute("PRAGMA page_size=1024")
+    conn.execute(f"PRAGMA journal_mode={journal_mode}")
+    conn.execute(SCHEMA)
+    return conn
+
+
+def put(conn, key, value):
+    conn.execute("INSERT INTO ItemTable VALUES (?, ?)", (key, value))
+
+
+def filler(conn, prefix, count):
+    for i in range(count):
+        put(conn, f"{prefix}/{i}", "x" * 200)
+
+
+def rollback():
+    """A database in the default rollback-journal mode, with no journal left over."""
+    conn = connect("rollback.vscdb", "DELETE")
+    put(conn, "cursorAuth/accessToken", "rollback-token")
+    put(conn, "telemetry.machineId", "rollback-machine")
+    filler(conn, "workbench", 40)
+    conn.close()
+
+
+def hot_journal():
+    """A copy taken while a writer held the database locked in the middle of a
+    transaction, after it had spilled uncommitted pages into the main file. The
+    -journal holds the committed originals."""
+    conn = connect("locked.vscdb", "DELETE")
+    put(conn, "cursorAuth/accessToken", "committed-token")
+    filler(conn, "workbench", 40)
+    conn.execute("PRAGMA cache_size=10")
+    conn.execute("BEGIN EXCLUSIVE")
+    put(conn, "cursorAuth/accessToken", "uncommitted-token")
+    filler(conn, "spill", 200)
+    shutil.copy("locked.vscdb", "locked.vscdb.tmp")
+    shutil.copy("locked.vscdb-journal", "locked.vscdb-journal.tmp")
+    conn.execute("ROLLBACK")
+    conn.close()
+    os.replace("locked.vscdb.tmp", "locked.vscdb")
+    os.replace("locked.vscdb-journal.tmp", "locked.vscdb-journal")
+
+    # SQLite itself rolls the hot journal back when it opens the copy.
+    shutil.copy("locked.vscdb", "check.vscdb")
+    shutil.copy("locked.vscdb-journal", "check.vscdb-journal")
+    check = sqlite3.connect("check.vscdb")
+    token = check.execute("SELECT value FROM ItemTable WHERE key = 'cursorAuth/accessToken'").fetchone()[0]
+    check.close()
+    os.remove("check.vscdb")
+    assert token == "committed-token", token
+
+
+def wal():
+    """A WAL-mode database whose latest commit is only in the -wal file."""
+    conn = connect("wal.vscdb", "WAL")
+    conn.execute("PRAGMA wal_autocheckpoint=0")
+    put(conn, "cursorAuth/accessToken", "checkpointed-token")
+    filler(conn, "workbench", 10)
+    conn.execute("PRAGMA wal_checkpoint(TRUNCATE)")
+    put(conn, "cursorAuth/accessToken", "wal-token")
+    put(conn, "telemetry.machineId", "wal-machine")
+    shutil.copy("wal.vscdb", "wal.vscdb.tmp")
+    shutil.copy("wal.vscdb-wal", "wal.vscdb-wal.tmp")
+    conn.close()
+    os.replace("wal.vscdb.tmp", "wal.vscdb")
+    os.replace("wal.vscdb-wal.tmp", "wal.vscdb-wal")
+    if os.path.exists("wal.vscdb-shm"):
+        os.remove("wal.vscdb-shm")
+
+
+def overflow():
+    """Values larger than a page, in a table deep enough to need interior pages."""
+    conn = connect("overflow.vscdb", "DELETE")
+    filler(conn, "workbench", 300)
+    put(conn, "cursorAuth/accessToken", "".join(chr(ord("a") + i % 26) for i in range(5000)))
+    put(conn, "telemetry.machineId", "overflow-machine")
+    conn.close()
+
+
+if __name__ == "__main__":
+    rollback()
+    hot_journal()
+    wal()
+    overflow()
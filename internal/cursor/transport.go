@@ -0,0 +1,236 @@
+package cursor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/http2"
+)
+
+// TransportOptions configures how the client reaches the Cursor API. The zero value
+// uses the proxy from the environment, the system CA roots and default timeouts.
+type TransportOptions struct {
+	// ProxyURL overrides HTTPS_PROXY/HTTP_PROXY and NoProxy overrides NO_PROXY.
+	ProxyURL string
+	NoProxy  string
+	// CAFiles are PEM bundles trusted in addition to the system roots, e.g. the CA of
+	// a TLS-intercepting corporate proxy.
+	CAFiles []string
+	// ClientCertFile and ClientKeyFile hold an optional PEM client certificate.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	// FirstByteTimeout bounds the wait for response headers once the request is sent.
+	FirstByteTimeout time.Duration
+
+	// WarmAfterIdle is how long the client may go without a request before KeepWarm
+	// re-establishes the connection; negative disables warming.
+	WarmAfterIdle time.Duration
+}
+
+const (
+	defaultDialTimeout         = 5 * time.Second
+	defaultTLSHandshakeTimeout = 5 * time.Second
+	defaultFirstByteTimeout    = 15 * time.Second
+
+	// The HTTP/2 connection is pinged after pingAfterIdle without frames and dropped
+	// if the ping is not answered within pingTimeout, so a connection silently killed
+	// by a NAT or proxy is replaced before a completion request lands on it.
+	pingAfterIdle = 15 * time.Second
+	pingTimeout   = 5 * time.Second
+	idleConnTTL   = 10 * time.Minute
+)
+
+// Kinds of TransportError, from the closest hop outwards.
+const (
+	TransportErrorProxy   = "proxy"
+	TransportErrorDNS     = "dns"
+	TransportErrorConnect = "connect"
+	TransportErrorTLS     = "tls"
+	TransportErrorTimeout = "timeout"
+)
+
+// TransportError is a failure to reach the API at all, as opposed to an error the API
+// returned. Kind and Proxy say which hop failed.
+type TransportError struct {
+	Kind  string
+	Host  string
+	Proxy string
+	Err   error
+}
+
+func (e *TransportError) Error() string {
+	via := ""
+	if e.Proxy != "" {
+		via = " via proxy " + e.Proxy
+	}
+	return fmt.Sprintf("%s error reaching %s%s: %v", e.Kind, e.Host, via, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// newHTTPClient builds the HTTP client used for API and auth requests.
+func newHTTPClient(opts TransportOptions) (*http.Client, error) {
+	proxyConfig := httpproxy.FromEnvironment()
+	if opts.ProxyURL != "" {
+		proxyConfig.HTTPSProxy = opts.ProxyURL
+		proxyConfig.HTTPProxy = opts.ProxyURL
+	}
+	if opts.NoProxy != "" {
+		proxyConfig.NoProxy = opts.NoProxy
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+	proxy := func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dialTimeout := opts.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	handshakeTimeout := opts.TLSHandshakeTimeout
+	if handshakeTimeout <= 0 {
+		handshakeTimeout = defaultTLSHandshakeTimeout
+	}
+	firstByteTimeout := opts.FirstByteTimeout
+	if firstByteTimeout <= 0 {
+		firstByteTimeout = defaultFirstByteTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   handshakeTimeout,
+		ResponseHeaderTimeout: firstByteTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       idleConnTTL,
+		OnProxyConnectResponse: func(ctx context.Context, proxyURL *url.URL, req *http.Request, resp *http.Response) error {
+			if resp.StatusCode != http.StatusOK {
+				return &proxyRefusedError{host: req.Host, status: resp.Status}
+			}
+			return nil
+		},
+	}
+
+	h2, err := http2.ConfigureTransports(transport)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring HTTP/2: %w", err)
+	}
+	h2.ReadIdleTimeout = pingAfterIdle
+	h2.PingTimeout = pingTimeout
+
+	return &http.Client{Transport: &diagnosingTransport{base: transport, proxy: proxy}}, nil
+}
+
+func newTLSConfig(opts TransportOptions) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(opts.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range opts.CAFiles {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("error reading CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// diagnosingTransport turns connection failures into TransportErrors that say whether
+// the proxy, DNS, TCP or TLS was at fault.
+type diagnosingTransport struct {
+	base  http.RoundTripper
+	proxy func(*http.Request) (*url.URL, error)
+}
+
+func (t *diagnosingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil || req.Context().Err() != nil {
+		return resp, err
+	}
+
+	transportErr := &TransportError{Kind: classifyTransportError(err), Host: req.URL.Host, Err: err}
+	if proxyURL, _ := t.proxy(req); proxyURL != nil {
+		transportErr.Proxy = proxyURL.Redacted()
+	}
+	return nil, transportErr
+}
+
+func classifyTransportError(err error) string {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "proxyconnect" {
+		return TransportErrorProxy
+	}
+	var refused *proxyRefusedError
+	if errors.As(err, &refused) {
+		return TransportErrorProxy
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return TransportErrorDNS
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) || errors.As(err, &recordErr) {
+		return TransportErrorTLS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return TransportErrorTimeout
+	}
+	return TransportErrorConnect
+}
+
+// proxyRefusedError is a non-200 answer to CONNECT, typically 407 Proxy
+// Authentication Required or 403 from a proxy allowlist.
+type proxyRefusedError struct {
+	host   string
+	status string
+}
+
+func (e *proxyRefusedError) Error() string {
+	return fmt.Sprintf("proxy refused CONNECT to %s: %s", e.host, e.status)
+}
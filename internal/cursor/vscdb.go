@@ -0,0 +1,596 @@
+package cursor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// state.vscdb is a plain SQLite database holding a single key/value table:
+//
+//	CREATE TABLE ItemTable (key TEXT UNIQUE ON CONFLICT REPLACE, value BLOB)
+//
+// The reader below understands just enough of the SQLite file format to scan that
+// table without cgo or the sqlite3 binary. It never writes to the database and takes
+// no locks; pages committed to the -wal file Cursor keeps open are overlaid on top of
+// the main file, the same way SQLite readers see them. In rollback-journal mode a
+// writer holding the lock may already have written uncommitted pages to the main
+// file; their committed originals are read back from the -journal instead.
+
+const sqliteHeader = "SQLite format 3\x00"
+
+// errCorrupt marks reads that failed because the file did not parse. Cursor may be in
+// the middle of writing it, so these are retried.
+var errCorrupt = errors.New("malformed database")
+
+const (
+	readItemsAttempts = 3
+	readItemsBackoff  = 50 * time.Millisecond
+)
+
+// readItems returns the ItemTable values for the requested keys. Keys that are not
+// present are omitted from the result.
+func readItems(path string, keys ...string) (map[string]string, error) {
+	var err error
+	for attempt := 0; attempt < readItemsAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(readItemsBackoff)
+		}
+
+		var items map[string]string
+		items, err = readItemsOnce(path, keys)
+		if err == nil {
+			return items, nil
+		}
+		if !errors.Is(err, errCorrupt) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// readItem returns a single ItemTable value, or "" if the key is not present.
+func readItem(path, key string) (string, error) {
+	items, err := readItems(path, key)
+	if err != nil {
+		return "", err
+	}
+	return items[key], nil
+}
+
+func readItemsOnce(path string, keys []string) (map[string]string, error) {
+	db, err := openStateDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	root, err := db.tableRoot("ItemTable")
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+
+	items := make(map[string]string, len(keys))
+	err = db.scanTable(root, func(rec []sqliteValue) error {
+		if len(rec) < 2 {
+			return nil
+		}
+		key := db.text(rec[0])
+		if wanted[key] {
+			items[key] = db.text(rec[1])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+type stateDB struct {
+	path     string
+	file     *os.File
+	size     int64
+	pageSize int
+	usable   int
+	encoding uint32
+	wal      map[uint32][]byte
+	journal  map[uint32][]byte
+}
+
+func openStateDB(path string) (*stateDB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	db := &stateDB{path: path, file: file, size: info.Size()}
+	if err := db.readHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (db *stateDB) Close() error {
+	return db.file.Close()
+}
+
+func (db *stateDB) readHeader() error {
+	header := make([]byte, 100)
+	if _, err := db.file.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("%s: %w: file too short", db.path, errCorrupt)
+		}
+		return err
+	}
+	if string(header[:16]) != sqliteHeader {
+		return fmt.Errorf("%s is not a SQLite database", db.path)
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("%s: %w: invalid page size %d", db.path, errCorrupt, pageSize)
+	}
+
+	db.pageSize = pageSize
+	db.usable = pageSize - int(header[20])
+	db.encoding = binary.BigEndian.Uint32(header[56:60])
+
+	wal, err := readWAL(db.path+"-wal", pageSize)
+	if err != nil {
+		return err
+	}
+	db.wal = wal
+
+	journal, err := readHotJournal(db.path+"-journal", pageSize)
+	if err != nil {
+		return err
+	}
+	db.journal = journal
+
+	return nil
+}
+
+// page returns page n (1-based), preferring the committed original saved in a hot
+// journal, then the newest committed copy in the WAL.
+func (db *stateDB) page(n uint32) ([]byte, error) {
+	if p, ok := db.journal[n]; ok {
+		return p, nil
+	}
+	if p, ok := db.wal[n]; ok {
+		return p, nil
+	}
+
+	off := int64(n-1) * int64(db.pageSize)
+	if n == 0 || off+int64(db.pageSize) > db.size {
+		return nil, fmt.Errorf("%s: %w: page %d out of range", db.path, errCorrupt, n)
+	}
+
+	p := make([]byte, db.pageSize)
+	if _, err := db.file.ReadAt(p, off); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// tableRoot looks up a table's root page in sqlite_schema, which is rooted at page 1.
+func (db *stateDB) tableRoot(name string) (uint32, error) {
+	var root uint32
+	err := db.scanTable(1, func(rec []sqliteValue) error {
+		// type, name, tbl_name, rootpage, sql
+		if len(rec) < 4 || root != 0 {
+			return nil
+		}
+		if db.text(rec[0]) == "table" && strings.EqualFold(db.text(rec[1]), name) {
+			root = uint32(rec[3].integer)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if root == 0 {
+		return 0, fmt.Errorf("no %s table in %s", name, db.path)
+	}
+	return root, nil
+}
+
+const (
+	pageTableInterior = 0x05
+	pageTableLeaf     = 0x0d
+)
+
+// scanTable walks a table b-tree in rowid order and calls fn with every record.
+func (db *stateDB) scanTable(root uint32, fn func([]sqliteValue) error) error {
+	visited := make(map[uint32]bool)
+	var walk func(n uint32) error
+	walk = func(n uint32) error {
+		if visited[n] {
+			return fmt.Errorf("%s: %w: b-tree cycle at page %d", db.path, errCorrupt, n)
+		}
+		visited[n] = true
+
+		p, err := db.page(n)
+		if err != nil {
+			return err
+		}
+
+		hdr := 0
+		if n == 1 {
+			hdr = 100
+		}
+		if len(p) < hdr+12 {
+			return fmt.Errorf("%s: %w: short page %d", db.path, errCorrupt, n)
+		}
+
+		cells := int(binary.BigEndian.Uint16(p[hdr+3 : hdr+5]))
+		switch p[hdr] {
+		case pageTableLeaf:
+			ptrs := hdr + 8
+			if ptrs+2*cells > len(p) {
+				return fmt.Errorf("%s: %w: bad cell count on page %d", db.path, errCorrupt, n)
+			}
+			for i := 0; i < cells; i++ {
+				off := int(binary.BigEndian.Uint16(p[ptrs+2*i:]))
+				payload, err := db.leafPayload(p, off)
+				if err != nil {
+					return err
+				}
+				rec, err := parseRecord(payload)
+				if err != nil {
+					return fmt.Errorf("%s: page %d: %w", db.path, n, err)
+				}
+				if err := fn(rec); err != nil {
+					return err
+				}
+			}
+
+		case pageTableInterior:
+			ptrs := hdr + 12
+			if ptrs+2*cells > len(p) {
+				return fmt.Errorf("%s: %w: bad cell count on page %d", db.path, errCorrupt, n)
+			}
+			for i := 0; i < cells; i++ {
+				off := int(binary.BigEndian.Uint16(p[ptrs+2*i:]))
+				if off+4 > len(p) {
+					return fmt.Errorf("%s: %w: bad cell offset on page %d", db.path, errCorrupt, n)
+				}
+				if err := walk(binary.BigEndian.Uint32(p[off:])); err != nil {
+					return err
+				}
+			}
+			if err := walk(binary.BigEndian.Uint32(p[hdr+8:])); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("%s: %w: page %d is not a table page (type %#x)", db.path, errCorrupt, n, p[hdr])
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+// leafPayload reads the record stored in a table leaf cell, following overflow pages.
+func (db *stateDB) leafPayload(p []byte, off int) ([]byte, error) {
+	if off >= len(p) {
+		return nil, fmt.Errorf("%s: %w: cell offset out of range", db.path, errCorrupt)
+	}
+	total, n := readVarint(p[off:])
+	if n == 0 {
+		return nil, fmt.Errorf("%s: %w: bad payload length", db.path, errCorrupt)
+	}
+	off += n
+	_, n = readVarint(p[off:]) // rowid
+	if n == 0 {
+		return nil, fmt.Errorf("%s: %w: bad rowid", db.path, errCorrupt)
+	}
+	off += n
+
+	u := db.usable
+	maxLocal := u - 35
+	if total <= uint64(maxLocal) {
+		end := off + int(total)
+		if end > len(p) {
+			return nil, fmt.Errorf("%s: %w: payload overruns page", db.path, errCorrupt)
+		}
+		return p[off:end], nil
+	}
+
+	minLocal := (u-12)*32/255 - 23
+	local := minLocal + int((total-uint64(minLocal))%uint64(u-4))
+	if local > maxLocal {
+		local = minLocal
+	}
+	if off+local+4 > len(p) {
+		return nil, fmt.Errorf("%s: %w: payload overruns page", db.path, errCorrupt)
+	}
+
+	payload := make([]byte, 0, total)
+	payload = append(payload, p[off:off+local]...)
+	next := binary.BigEndian.Uint32(p[off+local:])
+	for uint64(len(payload)) < total {
+		if next == 0 {
+			return nil, fmt.Errorf("%s: %w: overflow chain ends early", db.path, errCorrupt)
+		}
+		ov, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = binary.BigEndian.Uint32(ov[:4])
+		chunk := u - 4
+		if remaining := total - uint64(len(payload)); remaining < uint64(chunk) {
+			chunk = int(remaining)
+		}
+		payload = append(payload, ov[4:4+chunk]...)
+	}
+
+	return payload, nil
+}
+
+// text decodes a TEXT or BLOB column using the database's text encoding.
+func (db *stateDB) text(v sqliteValue) string {
+	if !v.isText || db.encoding <= 1 {
+		return string(v.data)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if db.encoding == 3 {
+		order = binary.BigEndian
+	}
+	units := make([]uint16, len(v.data)/2)
+	for i := range units {
+		units[i] = order.Uint16(v.data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+type sqliteValue struct {
+	integer int64
+	data    []byte
+	isText  bool
+}
+
+// parseRecord decodes a record in the SQLite record format.
+func parseRecord(payload []byte) ([]sqliteValue, error) {
+	hdrLen, n := readVarint(payload)
+	if n == 0 || hdrLen > uint64(len(payload)) {
+		return nil, fmt.Errorf("%w: bad record header", errCorrupt)
+	}
+
+	var values []sqliteValue
+	body := int(hdrLen)
+	for pos := n; pos < int(hdrLen); {
+		serial, n := readVarint(payload[pos:int(hdrLen)])
+		if n == 0 {
+			return nil, fmt.Errorf("%w: bad serial type", errCorrupt)
+		}
+		pos += n
+
+		var size int
+		switch {
+		case serial <= 4:
+			size = int(serial)
+		case serial == 5:
+			size = 6
+		case serial == 6 || serial == 7:
+			size = 8
+		case serial == 8 || serial == 9:
+			size = 0
+		case serial >= 12:
+			size = int((serial - 12) / 2)
+		default:
+			return nil, fmt.Errorf("%w: reserved serial type %d", errCorrupt, serial)
+		}
+		if body+size > len(payload) {
+			return nil, fmt.Errorf("%w: record overruns payload", errCorrupt)
+		}
+		raw := payload[body : body+size]
+		body += size
+
+		var v sqliteValue
+		switch {
+		case serial >= 1 && serial <= 6:
+			v.integer = readInt(raw)
+		case serial == 9:
+			v.integer = 1
+		case serial >= 12:
+			v.data = raw
+			v.isText = serial%2 == 1
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// readInt decodes a big-endian two's complement integer of 1 to 8 bytes.
+func readInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// readVarint decodes a SQLite varint, returning the value and its length (0 if truncated).
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	if len(b) < 9 {
+		return 0, 0
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+const (
+	walMagicLE = 0x377f0682
+	walMagicBE = 0x377f0683
+)
+
+// readWAL returns the newest committed copy of every page in a write-ahead log.
+// A missing or unusable WAL is not an error: the main file is then authoritative.
+func readWAL(path string, pageSize int) (map[uint32][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(data) < 32 {
+		return nil, nil
+	}
+
+	magic := binary.BigEndian.Uint32(data[0:4])
+	if magic != walMagicLE && magic != walMagicBE {
+		return nil, nil
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if magic == walMagicBE {
+		order = binary.BigEndian
+	}
+	if int(binary.BigEndian.Uint32(data[8:12])) != pageSize {
+		return nil, nil
+	}
+
+	s0, s1 := walChecksum(order, data[0:24], 0, 0)
+	if s0 != binary.BigEndian.Uint32(data[24:28]) || s1 != binary.BigEndian.Uint32(data[28:32]) {
+		return nil, nil
+	}
+	salt := data[16:24]
+
+	committed := make(map[uint32][]byte)
+	pending := make(map[uint32][]byte)
+	frameSize := 24 + pageSize
+	for off := 32; off+frameSize <= len(data); off += frameSize {
+		hdr := data[off : off+24]
+		page := data[off+24 : off+frameSize]
+
+		// Frames left over from before the last WAL reset carry old salts.
+		if !bytes.Equal(hdr[8:16], salt) {
+			break
+		}
+		s0, s1 = walChecksum(order, hdr[0:8], s0, s1)
+		s0, s1 = walChecksum(order, page, s0, s1)
+		if s0 != binary.BigEndian.Uint32(hdr[16:20]) || s1 != binary.BigEndian.Uint32(hdr[20:24]) {
+			break
+		}
+
+		pending[binary.BigEndian.Uint32(hdr[0:4])] = page
+		if binary.BigEndian.Uint32(hdr[4:8]) != 0 {
+			// Commit frame: everything since the previous commit is now visible.
+			for n, p := range pending {
+				committed[n] = p
+			}
+			pending = make(map[uint32][]byte)
+		}
+	}
+
+	return committed, nil
+}
+
+func walChecksum(order binary.ByteOrder, b []byte, s0, s1 uint32) (uint32, uint32) {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s0 += order.Uint32(b[i:]) + s1
+		s1 += order.Uint32(b[i+4:]) + s0
+	}
+	return s0, s1
+}
+
+const journalMagic = "\xd9\xd5\x05\xf9\x20\xa1\x63\xd7"
+
+// readHotJournal returns the original copy of every page an unfinished transaction
+// has saved in a rollback journal. A missing journal, or one a commit has truncated
+// or zeroed the header of, is not an error: the main file is then authoritative.
+func readHotJournal(path string, pageSize int) (map[uint32][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	originals := make(map[uint32][]byte)
+	recordSize := 4 + pageSize + 4
+	for off := 0; off+28 <= len(data) && string(data[off:off+8]) == journalMagic; {
+		hdr := data[off:]
+		records := binary.BigEndian.Uint32(hdr[8:12])
+		nonce := binary.BigEndian.Uint32(hdr[12:16])
+		sectorSize := int(binary.BigEndian.Uint32(hdr[20:24]))
+		if sectorSize < 32 || sectorSize > 65536 || sectorSize&(sectorSize-1) != 0 ||
+			int(binary.BigEndian.Uint32(hdr[24:28])) != pageSize {
+			break
+		}
+
+		rec := off + sectorSize
+		if records == 0xffffffff {
+			records = uint32(max(len(data)-rec, 0) / recordSize)
+		}
+		for i := uint32(0); i < records; i++ {
+			if rec+recordSize > len(data) {
+				return originals, nil
+			}
+			n := binary.BigEndian.Uint32(data[rec:])
+			page := data[rec+4 : rec+4+pageSize]
+			if journalChecksum(page, nonce) != binary.BigEndian.Uint32(data[rec+4+pageSize:]) {
+				// Not yet synced; SQLite stops the rollback here too.
+				return originals, nil
+			}
+			// The first copy of a page is the one from before the transaction.
+			if _, ok := originals[n]; !ok {
+				originals[n] = page
+			}
+			rec += recordSize
+		}
+		// The next header, if any, starts on a sector boundary.
+		off = (rec + sectorSize - 1) / sectorSize * sectorSize
+	}
+
+	return originals, nil
+}
+
+// journalChecksum is the nonce plus every 200th byte of the page, counting down from
+// the end, as SQLite computes it.
+func journalChecksum(page []byte, nonce uint32) uint32 {
+	sum := nonce
+	for i := len(page) - 200; i > 0; i -= 200 {
+		sum += uint32(page[i])
+	}
+	return sum
+}
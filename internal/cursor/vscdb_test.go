@@ -0,0 +1,153 @@
+package cursor
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata are made by testdata/gen_vscdb.py.
+
+var credentialKeys = []string{"cursorAuth/accessToken", "telemetry.machineId", "cursorAuth/refreshToken"}
+
+func TestReadItems(t *testing.T) {
+	overflowToken := make([]byte, 5000)
+	for i := range overflowToken {
+		overflowToken[i] = byte('a' + i%26)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		keys []string
+		want map[string]string
+	}{
+		{
+			name: "rollback journal mode",
+			file: "rollback.vscdb",
+			keys: credentialKeys,
+			want: map[string]string{
+				"cursorAuth/accessToken": "rollback-token",
+				"telemetry.machineId":    "rollback-machine",
+			},
+		},
+		{
+			name: "locked with a hot journal",
+			file: "locked.vscdb",
+			keys: append([]string{"spill/0"}, credentialKeys...),
+			want: map[string]string{"cursorAuth/accessToken": "committed-token"},
+		},
+		{
+			name: "uncheckpointed WAL frames",
+			file: "wal.vscdb",
+			keys: credentialKeys,
+			want: map[string]string{
+				"cursorAuth/accessToken": "wal-token",
+				"telemetry.machineId":    "wal-machine",
+			},
+		},
+		{
+			name: "overflow pages",
+			file: "overflow.vscdb",
+			keys: append([]string{"workbench/299"}, credentialKeys...),
+			want: map[string]string{
+				"cursorAuth/accessToken": string(overflowToken),
+				"telemetry.machineId":    "overflow-machine",
+				"workbench/299":          strings.Repeat("x", 200),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readItems(filepath.Join("testdata", tt.file), tt.keys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readItems = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// copyFixture copies testdata files into a temporary directory, so they can be read
+// without the files that normally sit next to them.
+func copyFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadItemWithoutWAL(t *testing.T) {
+	path := copyFixture(t, "wal.vscdb")
+
+	got, err := readItem(path, "cursorAuth/accessToken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "checkpointed-token" {
+		t.Errorf("token = %q, want the checkpointed one", got)
+	}
+}
+
+func TestReadItemIgnoresFinishedJournal(t *testing.T) {
+	path := copyFixture(t, "rollback.vscdb")
+	// A journal_mode=PERSIST commit leaves the journal behind with its header zeroed.
+	if err := os.WriteFile(path+"-journal", make([]byte, 2048), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readItem(path, "cursorAuth/accessToken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "rollback-token" {
+		t.Errorf("token = %q, want %q", got, "rollback-token")
+	}
+}
+
+func TestReadItemMissingKey(t *testing.T) {
+	got, err := readItem(filepath.Join("testdata", "rollback.vscdb"), "no/such/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "" {
+		t.Errorf("missing key = %q, want empty", got)
+	}
+}
+
+func TestReadItemsErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := readItems(filepath.Join(dir, "missing.vscdb")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want not exist", err)
+	}
+
+	notSQLite := filepath.Join(dir, "settings.json")
+	if err := os.WriteFile(notSQLite, []byte(strings.Repeat("{}", 100)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readItems(notSQLite); err == nil || errors.Is(err, errCorrupt) {
+		t.Errorf("not a database: err = %v, want a permanent error", err)
+	}
+
+	truncated := copyFixture(t, "overflow.vscdb")
+	if err := os.Truncate(truncated, 4096); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readItems(truncated, "cursorAuth/accessToken"); !errors.Is(err, errCorrupt) {
+		t.Errorf("truncated file: err = %v, want %v", err, errCorrupt)
+	}
+}
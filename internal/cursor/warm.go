@@ -0,0 +1,65 @@
+package cursor
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DefaultWarmAfterIdle is how long the client may sit without a request before
+// KeepWarm opens a fresh connection.
+const DefaultWarmAfterIdle = 2 * time.Minute
+
+const warmTimeout = 10 * time.Second
+
+// KeepWarm makes sure the first completion after startup or a long pause does not pay
+// for DNS, TCP and the TLS handshake. It connects to the active endpoint right away
+// and again whenever the client has been idle for WarmAfterIdle. It returns when ctx
+// is done.
+func (c *Client) KeepWarm(ctx context.Context) {
+	if c.warmAfterIdle < 0 || c.inProcess {
+		return
+	}
+
+	c.warm(ctx)
+
+	ticker := time.NewTicker(c.warmAfterIdle / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if time.Since(time.Unix(0, c.lastUsed.Load())) >= c.warmAfterIdle {
+			c.warm(ctx)
+		}
+	}
+}
+
+// warm sends a HEAD request to the active endpoint. Any response at all leaves an
+// established connection in the pool; the status is irrelevant.
+func (c *Client) warm(ctx context.Context) {
+	c.lastUsed.Store(time.Now().UnixNano())
+
+	ctx, cancel := context.WithTimeout(ctx, warmTimeout)
+	defer cancel()
+	ctx, trace := withConnTrace(ctx)
+
+	baseURL := c.endpoints.activeURL()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL+"/", nil)
+	if err != nil {
+		return
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Debug("Failed to warm Cursor API connection", "base_url", baseURL, "error", err)
+		return
+	}
+	resp.Body.Close()
+
+	setup, reused, _ := trace.connected()
+	c.logger.Debug("Warmed Cursor API connection", "base_url", baseURL, "connect", setup, "reused", reused, "proto", resp.Proto)
+}
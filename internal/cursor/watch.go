@@ -0,0 +1,79 @@
+package cursor
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is how often WatchCredentials checks the credential database.
+const DefaultWatchInterval = 2 * time.Second
+
+// fileStamp identifies a version of a file well enough to notice it was rewritten.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// WatchCredentials polls the credential database at path, along with the -wal file
+// Cursor writes through, and reloads credentials from the client's provider whenever
+// either changes. A new token or machine ID is swapped in atomically, so signing out
+// and back in to Cursor takes effect without restarting. It returns when ctx is done.
+func (c *Client) WatchCredentials(ctx context.Context, path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	db, wal := statFile(path), statFile(path+"-wal")
+	c.logger.Info("Watching Cursor credentials", "path", path, "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		newDB, newWAL := statFile(path), statFile(path+"-wal")
+		if newDB == db && newWAL == wal {
+			continue
+		}
+		db, wal = newDB, newWAL
+
+		c.reloadCredentials()
+	}
+}
+
+// reloadCredentials re-reads the provider and installs the result if it differs.
+func (c *Client) reloadCredentials() {
+	creds, err := c.provider.Credentials()
+	if err != nil {
+		c.logger.Warn("Credential database changed but no credentials could be read", "error", err)
+		return
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	current := c.credentials.Load()
+	if creds.AccessToken == current.AccessToken && (creds.MachineID == "" || creds.MachineID == current.MachineID) {
+		return
+	}
+
+	if creds.MachineID != "" && creds.MachineID != current.MachineID {
+		c.logger.Info("Cursor machine ID changed")
+	}
+	c.swapCredentials(creds, "credential database changed")
+}
@@ -0,0 +1,229 @@
+package diffhistory
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is how many unchanged lines surround each change in a hunk.
+const contextLines = 3
+
+// maxMyersLines bounds the changed region Myers' algorithm is run on; its trace
+// grows quadratically. Larger regions are diffed as a plain replacement.
+const maxMyersLines = 500
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	// line includes its newline, except for a last line without one.
+	line string
+	// a and b are the 0-indexed line numbers in the old and new text before this op.
+	a, b int
+}
+
+// Unified returns the hunks of a unified diff from before to after, without file
+// headers, or "" if they are equal.
+func Unified(before, after string) string {
+	if before == after {
+		return ""
+	}
+	ops := diffLines(splitLines(before), splitLines(after))
+	return formatHunks(ops)
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script with Myers' algorithm. The common prefix
+// and suffix are split off first, which makes the usual keystroke-sized change
+// between snapshots cheap regardless of file size.
+func diffLines(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []op
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{kind: opEqual, line: a[i], a: i, b: i})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := 0; i < suffix; i++ {
+		ai, bi := len(a)-suffix+i, len(b)-suffix+i
+		ops = append(ops, op{kind: opEqual, line: a[ai], a: ai, b: bi})
+	}
+	return ops
+}
+
+// myers diffs a and b, whose first lines are at offsetA and offsetB in the full texts.
+func myers(a, b []string, offsetA, offsetB int) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	if max > maxMyersLines {
+		return replaceAll(a, b, offsetA, offsetB)
+	}
+
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offsetA, offsetB, max)
+			}
+		}
+	}
+	return nil
+}
+
+func replaceAll(a, b []string, offsetA, offsetB int) []op {
+	ops := make([]op, 0, len(a)+len(b))
+	for i, line := range a {
+		ops = append(ops, op{kind: opDelete, line: line, a: offsetA + i, b: offsetB})
+	}
+	for i, line := range b {
+		ops = append(ops, op{kind: opInsert, line: line, a: offsetA + len(a), b: offsetB + i})
+	}
+	return ops
+}
+
+func backtrack(trace [][]int, a, b []string, offsetA, offsetB, max int) []op {
+	var ops []op
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[max+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{kind: opEqual, line: a[x], a: offsetA + x, b: offsetB + y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, op{kind: opInsert, line: b[y], a: offsetA + x, b: offsetB + y})
+			} else {
+				x--
+				ops = append(ops, op{kind: opDelete, line: a[x], a: offsetA + x, b: offsetB + y})
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// formatHunks groups changes that are close together into hunks with context.
+func formatHunks(ops []op) string {
+	var out strings.Builder
+
+	i := 0
+	for i < len(ops) {
+		// Find the next change.
+		for i < len(ops) && ops[i].kind == opEqual {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk while the next change is within two contexts' reach.
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				end += min(contextLines, run-end)
+				break
+			}
+			end = run
+		}
+
+		writeHunk(&out, ops[start:end])
+		i = end
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []op) {
+	oldCount, newCount := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			oldCount++
+		}
+		if o.kind != opDelete {
+			newCount++
+		}
+	}
+	oldStart, newStart := ops[0].a+1, ops[0].b+1
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, o := range ops {
+		out.WriteByte(byte(o.kind))
+		out.WriteString(o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			out.WriteByte('\n')
+		}
+	}
+}
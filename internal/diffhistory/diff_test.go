@@ -0,0 +1,240 @@
+package diffhistory
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// applyUnified applies the hunks of diff to before, checking their headers and
+// context lines along the way.
+func applyUnified(t *testing.T, before, diff string) string {
+	t.Helper()
+	old := splitLines(before)
+	var out []string
+	next := 0 // index into old of the first line not yet copied
+
+	lines := strings.SplitAfter(diff, "\n")
+	for i := 0; i < len(lines) && lines[i] != ""; {
+		var oldStart, oldCount, newStart, newCount int
+		if _, err := fmt.Sscanf(lines[i], "@@ -%d,%d +%d,%d @@\n", &oldStart, &oldCount, &newStart, &newCount); err != nil {
+			t.Fatalf("bad hunk header %q: %v", lines[i], err)
+		}
+		i++
+		at := oldStart - 1
+		if oldCount == 0 {
+			at = oldStart
+		}
+		if at < next || at > len(old) {
+			t.Fatalf("hunk at old line %d overlaps or is out of range", oldStart)
+		}
+		out = append(out, old[next:at]...)
+		next = at
+		if want := len(out) + 1; newCount > 0 && newStart != want || newCount == 0 && newStart != want-1 {
+			t.Errorf("hunk %q starts at new line %d, want %d", lines[i-1], newStart, want)
+		}
+
+		removed, added := 0, 0
+		for ; i < len(lines) && lines[i] != "" && !strings.HasPrefix(lines[i], "@@"); i++ {
+			kind, text := lines[i][0], lines[i][1:]
+			switch kind {
+			case ' ', '-':
+				if next >= len(old) || strings.TrimSuffix(old[next], "\n") != strings.TrimSuffix(text, "\n") {
+					t.Fatalf("line %q does not match old line %d", lines[i], next+1)
+				}
+				if kind == ' ' {
+					out = append(out, old[next])
+					added++
+				}
+				removed++
+				next++
+			case '+':
+				out = append(out, text)
+				added++
+			default:
+				t.Fatalf("bad hunk line %q", lines[i])
+			}
+		}
+		if removed != oldCount || added != newCount {
+			t.Errorf("hunk has %d old and %d new lines, header says %d and %d", removed, added, oldCount, newCount)
+		}
+	}
+	return strings.Join(append(out, old[next:]...), "")
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          string
+	}{
+		{
+			name:   "identical",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+			want:   "",
+		},
+		{
+			name:   "both empty",
+			before: "",
+			after:  "",
+			want:   "",
+		},
+		{
+			name:   "from empty",
+			before: "",
+			after:  "a\nb\n",
+			want:   "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:   "to empty",
+			before: "a\nb\n",
+			after:  "",
+			want:   "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:   "insert",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			after:  "1\n2\n3\n4\nnew\n5\n6\n7\n8\n",
+			want:   "@@ -2,6 +2,7 @@\n 2\n 3\n 4\n+new\n 5\n 6\n 7\n",
+		},
+		{
+			name:   "delete",
+			before: "1\n2\n3\n4\n5\n",
+			after:  "1\n2\n4\n5\n",
+			want:   "@@ -1,5 +1,4 @@\n 1\n 2\n-3\n 4\n 5\n",
+		},
+		{
+			name:   "replace",
+			before: "func main() {\n\tprint(1)\n}\n",
+			after:  "func main() {\n\tprintln(1)\n}\n",
+			want:   "@@ -1,3 +1,3 @@\n func main() {\n-\tprint(1)\n+\tprintln(1)\n }\n",
+		},
+		{
+			name:   "distant changes make two hunks",
+			before: "a\n1\n2\n3\n4\n5\n6\n7\nb\n",
+			after:  "A\n1\n2\n3\n4\n5\n6\n7\nB\n",
+			want:   "@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+		{
+			name:   "close changes share a hunk",
+			before: "a\n1\n2\nb\n",
+			after:  "A\n1\n2\nB\n",
+			want:   "@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n-b\n+B\n",
+		},
+		{
+			name:   "no newline at end",
+			before: "a\nb",
+			after:  "a\nc",
+			want:   "@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified(tt.before, tt.after)
+			if got != tt.want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, tt.want)
+			}
+			// The format has no "\ No newline at end of file" marker, so an inserted last
+			// line always comes back with a newline.
+			want := tt.after
+			if want != "" && !strings.HasSuffix(want, "\n") {
+				want += "\n"
+			}
+			if got := applyUnified(t, tt.before, got); got != want {
+				t.Errorf("applying the diff gives %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// lcs is the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestUnifiedRandomEdits(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"a\n", "b\n", "c\n", "d\n", "}\n", "\n"}
+	random := func(n int) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = words[rng.Intn(len(words))]
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a := random(rng.Intn(30))
+		b := append([]string(nil), a...)
+		for edits := rng.Intn(6); edits > 0; edits-- {
+			at := rng.Intn(len(b) + 1)
+			switch rng.Intn(3) {
+			case 0:
+				b = append(b[:at], append(random(1+rng.Intn(3)), b[at:]...)...)
+			case 1:
+				if at < len(b) {
+					b = append(b[:at], b[at+1:]...)
+				}
+			case 2:
+				if at < len(b) {
+					b[at] = words[rng.Intn(len(words))]
+				}
+			}
+		}
+		before, after := strings.Join(a, ""), strings.Join(b, "")
+
+		diff := Unified(before, after)
+		if got := applyUnified(t, before, diff); got != after {
+			t.Fatalf("%q -> %q: applying\n%s gives %q", before, after, diff, got)
+		}
+
+		// Myers finds a shortest edit script.
+		var deletes, inserts int
+		for _, o := range diffLines(a, b) {
+			switch o.kind {
+			case opDelete:
+				deletes++
+			case opInsert:
+				inserts++
+			}
+		}
+		common := lcs(a, b)
+		if deletes != len(a)-common || inserts != len(b)-common {
+			t.Fatalf("%q -> %q: %d deletes and %d inserts, want %d and %d",
+				before, after, deletes, inserts, len(a)-common, len(b)-common)
+		}
+	}
+}
+
+func TestUnifiedLargeChange(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < maxMyersLines; i++ {
+		fmt.Fprintf(&a, "old %d\n", i)
+		fmt.Fprintf(&b, "new %d\n", i)
+	}
+	before := "head\n" + a.String() + "tail\n"
+	after := "head\n" + b.String() + "tail\n"
+
+	diff := Unified(before, after)
+	if got := applyUnified(t, before, diff); got != after {
+		t.Errorf("applying the replacement diff gives a different text")
+	}
+	if n := strings.Count(diff, "\n-"); n != maxMyersLines {
+		t.Errorf("%d deleted lines, want %d", n, maxMyersLines)
+	}
+}
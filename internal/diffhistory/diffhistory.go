@@ -0,0 +1,163 @@
+// Package diffhistory remembers recent snapshots of the files being edited and turns
+// them into the diff history Cursor's model uses to follow what the user is doing.
+package diffhistory
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults for Options fields left zero.
+const (
+	DefaultMaxFiles       = 20
+	DefaultMaxDiffs       = 10
+	DefaultMaxFileBytes   = 1 << 20
+	DefaultCoalesceWindow = 2 * time.Second
+)
+
+// Options bounds what a Tracker keeps.
+type Options struct {
+	// MaxFiles is how many files are tracked; the least recently edited is dropped.
+	MaxFiles int
+	// MaxDiffs is how many diffs are kept per file.
+	MaxDiffs int
+	// MaxFileBytes skips files larger than this, which are rarely hand-edited.
+	MaxFileBytes int
+	// CoalesceWindow merges a change into the previous diff of the same file if that
+	// was made less than this long ago, so a burst of typing becomes one diff.
+	CoalesceWindow time.Duration
+}
+
+// Diff is one change to a file, as unified diff hunks.
+type Diff struct {
+	Text string
+	At   time.Time
+}
+
+// File is the recent history of one file.
+type File struct {
+	Path string
+	// Diffs are oldest first.
+	Diffs []Diff
+	// Merged is a single diff from before the oldest of Diffs to the latest snapshot.
+	Merged string
+}
+
+// Tracker keeps a bounded snapshot history per file. It is safe for concurrent use.
+type Tracker struct {
+	opts Options
+
+	mu    sync.Mutex
+	files map[fileKey]*fileHistory
+}
+
+type fileKey struct {
+	workspace string
+	path      string
+}
+
+type fileHistory struct {
+	latest string
+	// bases[i] is the snapshot diffs[i] was computed from.
+	bases    []string
+	diffs    []Diff
+	lastSeen time.Time
+}
+
+func New(opts Options) *Tracker {
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DefaultMaxFiles
+	}
+	if opts.MaxDiffs <= 0 {
+		opts.MaxDiffs = DefaultMaxDiffs
+	}
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = DefaultMaxFileBytes
+	}
+	if opts.CoalesceWindow == 0 {
+		opts.CoalesceWindow = DefaultCoalesceWindow
+	}
+	return &Tracker{opts: opts, files: make(map[fileKey]*fileHistory)}
+}
+
+// Observe records the contents of a file at time at. The first snapshot of a file
+// only sets the baseline; later ones that differ add a diff.
+func (t *Tracker) Observe(workspace, path, contents string, at time.Time) {
+	key := fileKey{workspace, path}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.files[key]
+	if len(contents) > t.opts.MaxFileBytes {
+		delete(t.files, key)
+		return
+	}
+	if !ok {
+		t.files[key] = &fileHistory{latest: contents, lastSeen: at}
+		t.evict()
+		return
+	}
+	h.lastSeen = at
+	if contents == h.latest {
+		return
+	}
+
+	last := len(h.diffs) - 1
+	if last >= 0 && at.Sub(h.diffs[last].At) < t.opts.CoalesceWindow {
+		if diff := Unified(h.bases[last], contents); diff != "" {
+			h.diffs[last] = Diff{Text: diff, At: at}
+		} else {
+			// The burst undid itself.
+			h.bases, h.diffs = h.bases[:last], h.diffs[:last]
+		}
+	} else {
+		h.bases = append(h.bases, h.latest)
+		h.diffs = append(h.diffs, Diff{Text: Unified(h.latest, contents), At: at})
+	}
+	h.latest = contents
+
+	if extra := len(h.diffs) - t.opts.MaxDiffs; extra > 0 {
+		h.bases = append([]string(nil), h.bases[extra:]...)
+		h.diffs = append([]Diff(nil), h.diffs[extra:]...)
+	}
+}
+
+// evict drops the least recently seen files beyond MaxFiles.
+func (t *Tracker) evict() {
+	for len(t.files) > t.opts.MaxFiles {
+		var oldest fileKey
+		var oldestSeen time.Time
+		first := true
+		for key, h := range t.files {
+			if first || h.lastSeen.Before(oldestSeen) {
+				oldest, oldestSeen, first = key, h.lastSeen, false
+			}
+		}
+		delete(t.files, oldest)
+	}
+}
+
+// History returns the files in workspace with at least one diff, ordered by their
+// latest diff, oldest first.
+func (t *Tracker) History(workspace string) []File {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var files []File
+	for key, h := range t.files {
+		if key.workspace != workspace || len(h.diffs) == 0 {
+			continue
+		}
+		files = append(files, File{
+			Path:   key.path,
+			Diffs:  append([]Diff(nil), h.diffs...),
+			Merged: Unified(h.bases[0], h.latest),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Diffs[len(files[i].Diffs)-1].At.Before(files[j].Diffs[len(files[j].Diffs)-1].At)
+	})
+	return files
+}
@@ -0,0 +1,105 @@
+package diffhistory
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.Unix(1000, 0)
+
+func TestTrackerCoalesces(t *testing.T) {
+	tracker := New(Options{CoalesceWindow: time.Second})
+	tracker.Observe("/work", "a.go", "x\n", t0)
+	if files := tracker.History("/work"); len(files) != 0 {
+		t.Fatalf("history after the baseline = %+v, want none", files)
+	}
+
+	// A burst of typing is one diff, from the baseline to the end of the burst.
+	tracker.Observe("/work", "a.go", "x\ny\n", t0.Add(100*time.Millisecond))
+	tracker.Observe("/work", "a.go", "x\nyz\n", t0.Add(500*time.Millisecond))
+	files := tracker.History("/work")
+	if len(files) != 1 || len(files[0].Diffs) != 1 {
+		t.Fatalf("history = %+v, want one file with one diff", files)
+	}
+	if want := Unified("x\n", "x\nyz\n"); files[0].Diffs[0].Text != want {
+		t.Errorf("coalesced diff = %q, want %q", files[0].Diffs[0].Text, want)
+	}
+
+	// After a pause the next change starts a new diff.
+	tracker.Observe("/work", "a.go", "w\nx\nyz\n", t0.Add(2*time.Second))
+	files = tracker.History("/work")
+	if len(files[0].Diffs) != 2 {
+		t.Fatalf("diffs = %+v, want two", files[0].Diffs)
+	}
+	if want := Unified("x\n", "w\nx\nyz\n"); files[0].Merged != want {
+		t.Errorf("merged = %q, want %q", files[0].Merged, want)
+	}
+
+	// A burst that undoes itself leaves no diff behind.
+	tracker.Observe("/work", "a.go", "w\nx\nyz\nq\n", t0.Add(4*time.Second))
+	tracker.Observe("/work", "a.go", "w\nx\nyz\n", t0.Add(4500*time.Millisecond))
+	if files := tracker.History("/work"); len(files[0].Diffs) != 2 {
+		t.Errorf("diffs after an undone burst = %+v, want the two before it", files[0].Diffs)
+	}
+}
+
+func TestTrackerMaxDiffs(t *testing.T) {
+	tracker := New(Options{MaxDiffs: 3, CoalesceWindow: -1})
+	contents := ""
+	for i := 0; i <= 5; i++ {
+		contents += fmt.Sprintf("line %d\n", i)
+		tracker.Observe("/work", "a.go", contents, t0.Add(time.Duration(i)*time.Minute))
+	}
+
+	files := tracker.History("/work")
+	if len(files) != 1 || len(files[0].Diffs) != 3 {
+		t.Fatalf("history = %+v, want three diffs", files)
+	}
+	if !strings.Contains(files[0].Diffs[0].Text, "+line 3") {
+		t.Errorf("oldest kept diff = %q, want the one adding line 3", files[0].Diffs[0].Text)
+	}
+	// Merged starts where the oldest kept diff does.
+	if want := Unified("line 0\nline 1\nline 2\n", contents); files[0].Merged != want {
+		t.Errorf("merged = %q, want %q", files[0].Merged, want)
+	}
+}
+
+func TestTrackerMaxFiles(t *testing.T) {
+	tracker := New(Options{MaxFiles: 2})
+	for i, path := range []string{"a.go", "b.go", "c.go"} {
+		at := t0.Add(time.Duration(i) * time.Minute)
+		tracker.Observe("/work", path, "", at)
+		tracker.Observe("/work", path, "edit\n", at.Add(time.Second))
+	}
+
+	files := tracker.History("/work")
+	if len(files) != 2 || files[0].Path != "b.go" || files[1].Path != "c.go" {
+		t.Errorf("history = %+v, want b.go and c.go, oldest first", files)
+	}
+}
+
+func TestTrackerMaxFileBytes(t *testing.T) {
+	tracker := New(Options{MaxFileBytes: 10})
+	tracker.Observe("/work", "a.go", "short\n", t0)
+	tracker.Observe("/work", "a.go", "short\nx\n", t0.Add(time.Minute))
+	tracker.Observe("/work", "a.go", strings.Repeat("long\n", 10), t0.Add(2*time.Minute))
+
+	if files := tracker.History("/work"); len(files) != 0 {
+		t.Errorf("history = %+v, want the file dropped once it grew too large", files)
+	}
+}
+
+func TestTrackerHistoryByWorkspace(t *testing.T) {
+	tracker := New(Options{})
+	tracker.Observe("/one", "a.go", "", t0)
+	tracker.Observe("/one", "a.go", "x\n", t0.Add(time.Minute))
+	tracker.Observe("/two", "a.go", "", t0)
+	tracker.Observe("/two", "a.go", "y\n", t0.Add(time.Minute))
+
+	files := tracker.History("/two")
+	if len(files) != 1 || !strings.Contains(files[0].Diffs[0].Text, "+y") {
+		t.Errorf("history of /two = %+v, want its own a.go only", files)
+	}
+}
@@ -0,0 +1,268 @@
+// Package document keeps the server's copy of the buffers an editor syncs with
+// open/change/close notifications, so suggestion requests need not carry whole files.
+package document
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxDocuments bounds the store; the least recently used document is dropped first.
+const MaxDocuments = 500
+
+// maxChangeLog is how many applied changes each document remembers for backends
+// that forward edits instead of contents.
+const maxChangeLog = 100
+
+var (
+	// ErrNotOpen is returned for a change to a document that was never opened, or was
+	// closed or evicted.
+	ErrNotOpen = errors.New("document not open")
+	// ErrVersionMismatch is returned when a change does not follow the stored version.
+	ErrVersionMismatch = errors.New("document version mismatch")
+)
+
+// Position is a 0-indexed line and a byte offset within it. Positions past the end of
+// a line or of the document are clamped to it.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Change replaces Range with Text, like an LSP didChange content change. A change
+// without a range replaces the whole document.
+type Change struct {
+	Range *Range `json:"range,omitempty"`
+	Text  string `json:"text"`
+}
+
+// AppliedChange is a change resolved against the text it was applied to.
+type AppliedChange struct {
+	// Version is the document version the change produced.
+	Version int32
+	// Start and End are byte offsets into the previous text, at StartPos and EndPos.
+	Start, End       int
+	StartPos, EndPos Position
+	Text             string
+	// Length is the length of the document after the change.
+	Length int
+	// UTF16 has the same offsets counted in UTF-16 code units, as VS Code counts them.
+	UTF16 UTF16Offsets
+}
+
+// UTF16Offsets are the offsets of an AppliedChange in UTF-16 code units. Lines are the
+// same as in StartPos and EndPos.
+type UTF16Offsets struct {
+	Start, End             int
+	StartColumn, EndColumn int
+	Length                 int
+}
+
+// Snapshot is a document at one version. It must not be modified.
+type Snapshot struct {
+	Workspace  string
+	Path       string
+	LanguageID string
+	Version    int32
+	Contents   string
+	// Changes are the most recent changes, oldest first, ending at Version.
+	Changes []AppliedChange
+	// ChangesFrom is the version Changes start from.
+	ChangesFrom int32
+}
+
+type key struct {
+	workspace string
+	path      string
+}
+
+type entry struct {
+	snapshot *Snapshot
+	used     time.Time
+}
+
+// Store holds the open documents. It is safe for concurrent use.
+type Store struct {
+	mu   sync.Mutex
+	docs map[key]*entry
+}
+
+func NewStore() *Store {
+	return &Store{docs: make(map[key]*entry)}
+}
+
+// Open sets a document's contents and version, replacing any previous state.
+func (s *Store) Open(workspace, path, languageID string, version int32, contents string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.docs[key{workspace, path}] = &entry{
+		snapshot: &Snapshot{
+			Workspace:   workspace,
+			Path:        path,
+			LanguageID:  languageID,
+			Version:     version,
+			Contents:    contents,
+			ChangesFrom: version,
+		},
+		used: time.Now(),
+	}
+	s.evict()
+}
+
+// Change applies changes in order and sets the document to version, which must be
+// one more than the stored version.
+func (s *Store) Change(workspace, path string, version int32, changes []Change) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.docs[key{workspace, path}]
+	if !ok {
+		return nil, ErrNotOpen
+	}
+	old := e.snapshot
+	if version != old.Version+1 {
+		return nil, fmt.Errorf("%w: have %d, got change to %d", ErrVersionMismatch, old.Version, version)
+	}
+
+	contents := old.Contents
+	log := old.Changes
+	changesFrom := old.ChangesFrom
+	for _, change := range changes {
+		applied := apply(contents, change)
+		applied.Version = version
+		contents = contents[:applied.Start] + change.Text + contents[applied.End:]
+		applied.Length = len(contents)
+		applied.UTF16.Length = utf16Len(contents)
+		log = append(log, applied)
+	}
+	if extra := len(log) - maxChangeLog; extra > 0 {
+		// Drop whole versions only, so the log never starts halfway through one.
+		changesFrom = log[extra-1].Version
+		for extra < len(log) && log[extra].Version == changesFrom {
+			extra++
+		}
+		log = log[extra:]
+	}
+
+	e.snapshot = &Snapshot{
+		Workspace:  workspace,
+		Path:       path,
+		LanguageID: old.LanguageID,
+		Version:    version,
+		Contents:   contents,
+		// Copied so that snapshots handed out earlier never see later appends.
+		Changes:     append([]AppliedChange(nil), log...),
+		ChangesFrom: changesFrom,
+	}
+	e.used = time.Now()
+	return e.snapshot, nil
+}
+
+func (s *Store) Close(workspace, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.docs, key{workspace, path})
+}
+
+// Get returns the current snapshot of a document.
+func (s *Store) Get(workspace, path string) (*Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.docs[key{workspace, path}]
+	if !ok {
+		return nil, false
+	}
+	e.used = time.Now()
+	return e.snapshot, true
+}
+
+func (s *Store) evict() {
+	for len(s.docs) > MaxDocuments {
+		var oldest key
+		var oldestUsed time.Time
+		first := true
+		for k, e := range s.docs {
+			if first || e.used.Before(oldestUsed) {
+				oldest, oldestUsed, first = k, e.used, false
+			}
+		}
+		delete(s.docs, oldest)
+	}
+}
+
+func apply(contents string, change Change) AppliedChange {
+	var applied AppliedChange
+	if change.Range == nil {
+		applied = AppliedChange{
+			Start:    0,
+			End:      len(contents),
+			StartPos: Position{},
+			EndPos:   endPosition(contents),
+			Text:     change.Text,
+		}
+	} else {
+		start, startPos := offset(contents, change.Range.Start)
+		end, endPos := offset(contents, change.Range.End)
+		if end < start {
+			start, end = end, start
+			startPos, endPos = endPos, startPos
+		}
+		applied = AppliedChange{Start: start, End: end, StartPos: startPos, EndPos: endPos, Text: change.Text}
+	}
+
+	applied.UTF16.Start = utf16Len(contents[:applied.Start])
+	applied.UTF16.End = applied.UTF16.Start + utf16Len(contents[applied.Start:applied.End])
+	applied.UTF16.StartColumn = utf16Len(contents[applied.Start-applied.StartPos.Character : applied.Start])
+	applied.UTF16.EndColumn = utf16Len(contents[applied.End-applied.EndPos.Character : applied.End])
+	return applied
+}
+
+// utf16Len is the length of s in UTF-16 code units. Invalid bytes count as one
+// replacement character each.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return n
+}
+
+// offset resolves pos to a byte offset, clamping it to the document.
+func offset(contents string, pos Position) (int, Position) {
+	if pos.Line < 0 {
+		return 0, Position{}
+	}
+	lineStart := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(contents[lineStart:], '\n')
+		if next < 0 {
+			return len(contents), endPosition(contents)
+		}
+		lineStart += next + 1
+	}
+
+	lineEnd := len(contents)
+	if next := strings.IndexByte(contents[lineStart:], '\n'); next >= 0 {
+		lineEnd = lineStart + next
+	}
+	character := min(max(pos.Character, 0), lineEnd-lineStart)
+	return lineStart + character, Position{Line: pos.Line, Character: character}
+}
+
+func endPosition(contents string) Position {
+	lastLine := strings.LastIndexByte(contents, '\n') + 1
+	return Position{Line: strings.Count(contents, "\n"), Character: len(contents) - lastLine}
+}
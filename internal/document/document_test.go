@@ -0,0 +1,64 @@
+package document
+
+import (
+	"testing"
+)
+
+func TestChangeUTF16Offsets(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		change   Change
+		want     UTF16Offsets
+		// wantBytes are Start and End in bytes.
+		wantBytes [2]int
+	}{
+		{
+			name:      "ascii",
+			contents:  "abc\ndef\n",
+			change:    Change{Range: &Range{Start: Position{1, 1}, End: Position{1, 2}}, Text: "X"},
+			want:      UTF16Offsets{Start: 5, End: 6, StartColumn: 1, EndColumn: 2, Length: 8},
+			wantBytes: [2]int{5, 6},
+		},
+		{
+			name:      "accent before the edit",
+			contents:  "// café\nx := 1\n",
+			change:    Change{Range: &Range{Start: Position{1, 5}, End: Position{1, 6}}, Text: "2"},
+			want:      UTF16Offsets{Start: 13, End: 14, StartColumn: 5, EndColumn: 6, Length: 15},
+			wantBytes: [2]int{14, 15},
+		},
+		{
+			name:     "astral character on the edited line",
+			contents: "s := \"🙂\" + x\n",
+			// Bytes 14 to 15 are the "x" after the four-byte emoji, a surrogate pair.
+			change:    Change{Range: &Range{Start: Position{0, 14}, End: Position{0, 15}}, Text: "yz"},
+			want:      UTF16Offsets{Start: 12, End: 13, StartColumn: 12, EndColumn: 13, Length: 15},
+			wantBytes: [2]int{14, 15},
+		},
+		{
+			name:      "whole document",
+			contents:  "é\n",
+			change:    Change{Text: "日本"},
+			want:      UTF16Offsets{Start: 0, End: 2, StartColumn: 0, EndColumn: 0, Length: 2},
+			wantBytes: [2]int{0, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			store.Open("/work", "/work/a.go", "go", 1, tt.contents)
+			snapshot, err := store.Change("/work", "/work/a.go", 2, []Change{tt.change})
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied := snapshot.Changes[len(snapshot.Changes)-1]
+			if applied.UTF16 != tt.want {
+				t.Errorf("UTF-16 offsets = %+v, want %+v", applied.UTF16, tt.want)
+			}
+			if got := [2]int{applied.Start, applied.End}; got != tt.wantBytes {
+				t.Errorf("byte offsets = %v, want %v", got, tt.wantBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Package fakeupstream stands in for the Cursor API during plugin development. The
+// generator answers every StreamCpp call with a deterministic chain of edits streamed
+// with realistic delays, so editor behaviour such as chaining via next_suggestion_id
+// can be worked on and demoed without a Cursor account.
+package fakeupstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"connectrpc.com/connect"
+	aiserverv1 "github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1"
+	"github.com/bengu3/cursor-tab.nvim/cursor-api/gen/aiserver/v1/aiserverv1connect"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+)
+
+const (
+	// editsPerChain is how many edits one response suggests.
+	editsPerChain = 3
+	// lineStride spaces the edits out so each one moves the cursor visibly.
+	lineStride = 2
+	chunkSize  = 8
+
+	firstChunkDelay = 150 * time.Millisecond
+	minChunkDelay   = 10 * time.Millisecond
+	maxChunkDelay   = 40 * time.Millisecond
+)
+
+// Generator is an AiService whose StreamCpp appends a marker comment to the cursor
+// line and the lines below it. The same request always gets the same response.
+type Generator struct {
+	aiserverv1connect.UnimplementedAiServiceHandler
+}
+
+func NewGenerator() *Generator {
+	return &Generator{}
+}
+
+// New returns the fake upstream named by the --fake-upstream flag: "generate" for the
+// generator, or a directory of fixtures in the record/replay format that are served
+// in turn to requests they were not recorded for.
+func New(spec string) (aiserverv1connect.AiServiceHandler, error) {
+	if spec == "generate" {
+		return NewGenerator(), nil
+	}
+
+	fixtures, err := cursor.LoadFixtures(spec)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := cursor.NewReplayHandler(fixtures)
+	if err != nil {
+		return nil, err
+	}
+	handler.Cycle = true
+	return handler, nil
+}
+
+// StreamCpp implements aiserverv1connect.AiServiceHandler.
+func (g *Generator) StreamCpp(ctx context.Context, req *connect.Request[aiserverv1.StreamCppRequest], stream *connect.ServerStream[aiserverv1.StreamCppResponse]) error {
+	file := req.Msg.GetCurrentFile()
+	if file.GetRelyOnFilesync() {
+		// There is no file store to apply edits to; the client resends the contents.
+		return connect.NewError(connect.CodeFailedPrecondition, errors.New("filesync is not supported by the fake upstream"))
+	}
+	lines := strings.Split(file.GetContents(), "\n")
+	cursorLine := int(file.GetCursorPosition().GetLine())
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:%d:%d", file.GetRelativeWorkspacePath(), cursorLine, file.GetCursorPosition().GetColumn())
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	comment := commentPrefix(file.GetLanguageId())
+
+	send := func(resp *aiserverv1.StreamCppResponse, delay time.Duration) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		return stream.Send(resp)
+	}
+	chunkDelay := func() time.Duration {
+		return minChunkDelay + time.Duration(rng.Int63n(int64(maxChunkDelay-minChunkDelay)))
+	}
+
+	delay := firstChunkDelay
+	for edit := 0; edit < editsPerChain; edit++ {
+		target := cursorLine + edit*lineStride
+		if target < 0 || target >= len(lines) {
+			break
+		}
+
+		if edit > 0 {
+			if err := send(&aiserverv1.StreamCppResponse{BeginEdit: ptr(true)}, chunkDelay()); err != nil {
+				return err
+			}
+		}
+
+		lineNumber := int32(target + 1)
+		bindingID := fmt.Sprintf("fake-%d", edit+1)
+		rangeChunk := &aiserverv1.StreamCppResponse{
+			RangeToReplace: &aiserverv1.LineRange{
+				StartLineNumber:        lineNumber,
+				EndLineNumberInclusive: lineNumber,
+			},
+			BindingId: &bindingID,
+		}
+		if err := send(rangeChunk, delay); err != nil {
+			return err
+		}
+		delay = chunkDelay()
+
+		text := strings.TrimRight(lines[target], " \t") + fmt.Sprintf(" %s fake edit %d of %d", comment, edit+1, editsPerChain)
+		for len(text) > 0 {
+			// Text is a proto string, which must not be cut inside a character.
+			n := min(chunkSize, len(text))
+			for n < len(text) && !utf8.RuneStart(text[n]) {
+				n--
+			}
+			if err := send(&aiserverv1.StreamCppResponse{Text: text[:n]}, chunkDelay()); err != nil {
+				return err
+			}
+			text = text[n:]
+		}
+
+		if err := send(&aiserverv1.StreamCppResponse{DoneEdit: ptr(true)}, chunkDelay()); err != nil {
+			return err
+		}
+	}
+
+	return send(&aiserverv1.StreamCppResponse{DoneStream: ptr(true)}, chunkDelay())
+}
+
+func commentPrefix(languageID string) string {
+	switch languageID {
+	case "lua", "sql", "haskell":
+		return "--"
+	case "python", "sh", "bash", "zsh", "ruby", "perl", "yaml", "toml", "r", "make", "dockerfile":
+		return "#"
+	case "vim":
+		return "\""
+	}
+	return "//"
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,63 @@
+package fakeupstream
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/cursor"
+)
+
+func TestGeneratorNonASCII(t *testing.T) {
+	client, err := cursor.NewClient(cursor.Options{Handler: NewGenerator()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each line puts a multi-byte character across an 8-byte chunk boundary.
+	contents := "// café au lait\nx := \"naïve\"\n// 日本語のコメント\ny := 1\n// émoji 🙂 here\n"
+	stream, err := client.Complete(context.Background(), &completion.Request{
+		WorkspacePath: "/work",
+		FilePath:      "/work/main.go",
+		FileContents:  contents,
+		LanguageID:    "go",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var edits []string
+	var text strings.Builder
+	for stream.Receive() {
+		switch event := stream.Event(); event.Kind {
+		case completion.EventText:
+			if !utf8.ValidString(event.Text) {
+				t.Errorf("chunk %q is not valid UTF-8", event.Text)
+			}
+			text.WriteString(event.Text)
+		case completion.EventDoneEdit:
+			edits = append(edits, text.String())
+			text.Reset()
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"// café au lait // fake edit 1 of 3",
+		"// 日本語のコメント // fake edit 2 of 3",
+		"// émoji 🙂 here // fake edit 3 of 3",
+	}
+	if len(edits) != len(want) {
+		t.Fatalf("edits = %q, want %q", edits, want)
+	}
+	for i := range want {
+		if edits[i] != want[i] {
+			t.Errorf("edit %d = %q, want %q", i+1, edits[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package fim is a completion backend for local models served over the
+// OpenAI-compatible /v1/completions endpoint, as offered by llama.cpp server and
+// Ollama, using fill-in-the-middle prompts.
+package fim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+)
+
+// CompleterName is the name the FIM backend reports to the completion package.
+const CompleterName = "fim"
+
+const (
+	defaultMaxTokens   = 128
+	defaultPrefixLines = 100
+	defaultSuffixLines = 40
+	defaultTimeout     = 10 * time.Second
+)
+
+// Options configures a Client. Only BaseURL is required.
+type Options struct {
+	// BaseURL is the server root, e.g. http://localhost:8080; /v1/completions is appended.
+	BaseURL string
+	Model   string
+	APIKey  string
+
+	// Template builds the prompt itself for servers that ignore the suffix field, with
+	// {prefix} and {suffix} placeholders, e.g.
+	// "<|fim_prefix|>{prefix}<|fim_suffix|>{suffix}<|fim_middle|>". When empty the
+	// prefix is sent as the prompt and the suffix in the suffix field.
+	Template string
+
+	MaxTokens   int
+	Temperature float64
+	Stop        []string
+
+	// PrefixLines and SuffixLines bound how much of the file around the cursor is sent.
+	PrefixLines int
+	SuffixLines int
+
+	HTTPClient *http.Client
+	Logger     *slog.Logger
+}
+
+type Client struct {
+	opts       Options
+	endpoint   string
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+func NewClient(opts Options) (*Client, error) {
+	if opts.BaseURL == "" {
+		return nil, fmt.Errorf("fim backend requires a base URL")
+	}
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = defaultMaxTokens
+	}
+	if opts.PrefixLines <= 0 {
+		opts.PrefixLines = defaultPrefixLines
+	}
+	if opts.SuffixLines <= 0 {
+		opts.SuffixLines = defaultSuffixLines
+	}
+
+	c := &Client{
+		opts:       opts,
+		endpoint:   strings.TrimRight(opts.BaseURL, "/") + "/v1/completions",
+		httpClient: opts.HTTPClient,
+		logger:     opts.Logger,
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return c, nil
+}
+
+// Name implements completion.Completer.
+func (c *Client) Name() string {
+	return CompleterName
+}
+
+type completionRequest struct {
+	Model       string   `json:"model,omitempty"`
+	Prompt      string   `json:"prompt"`
+	Suffix      string   `json:"suffix,omitempty"`
+	MaxTokens   int      `json:"max_tokens"`
+	Temperature float64  `json:"temperature"`
+	Stop        []string `json:"stop,omitempty"`
+	Stream      bool     `json:"stream"`
+}
+
+// Complete implements completion.Completer. The model's output is turned into a
+// single edit replacing the cursor line.
+func (c *Client) Complete(ctx context.Context, req *completion.Request) (completion.Stream, error) {
+	w := newWindow(req, c.opts.PrefixLines, c.opts.SuffixLines)
+
+	body := completionRequest{
+		Model:       c.opts.Model,
+		Prompt:      w.prefix,
+		Suffix:      w.suffix,
+		MaxTokens:   c.opts.MaxTokens,
+		Temperature: c.opts.Temperature,
+		Stop:        c.opts.Stop,
+		Stream:      true,
+	}
+	if c.opts.Template != "" {
+		body.Prompt = strings.NewReplacer("{prefix}", w.prefix, "{suffix}", w.suffix).Replace(c.opts.Template)
+		body.Suffix = ""
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding completion request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if c.opts.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.opts.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", c.endpoint, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %s: %s", c.endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return newEventStream(resp.Body, w, c.logger), nil
+}
@@ -0,0 +1,162 @@
+package fim
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+)
+
+// eventStream reads the server-sent events of a streamed completion and turns the
+// tokens into an edit of the cursor line as they arrive. Trailing whitespace is held
+// back until more text follows it, and so is an insertion that could still turn out
+// to be the rest of the line retyped.
+type eventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	window  window
+	logger  *slog.Logger
+
+	// inserted is the text received so far, of which the first sent bytes have been
+	// emitted. started is set once the edit's range has been emitted.
+	inserted strings.Builder
+	sent     int
+	started  bool
+	done     bool
+
+	events []completion.Event
+	event  completion.Event
+	err    error
+}
+
+func newEventStream(body io.ReadCloser, w window, logger *slog.Logger) *eventStream {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &eventStream{body: body, scanner: scanner, window: w, logger: logger}
+}
+
+type completionChunk struct {
+	Choices []struct {
+		Text         string  `json:"text"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *eventStream) Receive() bool {
+	for len(s.events) == 0 {
+		if s.done {
+			return false
+		}
+		s.readLine()
+	}
+	s.event, s.events = s.events[0], s.events[1:]
+	return true
+}
+
+// readLine reads one line of the response and queues the events it makes ready.
+func (s *eventStream) readLine() {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			s.fail(fmt.Errorf("stream error: %w", err))
+			return
+		}
+		s.finish()
+		return
+	}
+
+	data, ok := strings.CutPrefix(s.scanner.Text(), "data:")
+	if !ok {
+		return
+	}
+	data = strings.TrimSpace(data)
+	if data == "[DONE]" {
+		s.finish()
+		return
+	}
+
+	var chunk completionChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		s.fail(fmt.Errorf("error decoding completion chunk: %w", err))
+		return
+	}
+	if chunk.Error != nil {
+		s.fail(fmt.Errorf("completion failed: %s", chunk.Error.Message))
+		return
+	}
+	for _, choice := range chunk.Choices {
+		s.inserted.WriteString(choice.Text)
+	}
+	s.flush()
+}
+
+// flush emits the text received since the last flush, up to its trailing whitespace.
+func (s *eventStream) flush() {
+	ready := strings.TrimRight(s.inserted.String(), " \t\r\n")
+	if !s.started && (strings.TrimSpace(ready) == "" || strings.HasPrefix(s.window.after, ready)) {
+		return
+	}
+	s.emit(ready)
+}
+
+// emit queues ready past what has already been sent, starting the edit if needed.
+func (s *eventStream) emit(ready string) {
+	text := ready[s.sent:]
+	if !s.started {
+		s.started = true
+		s.events = append(s.events, completion.Event{Kind: completion.EventRange, Range: s.window.editRange()})
+		text = s.window.before + text
+	}
+	if text != "" {
+		s.events = append(s.events, completion.Event{Kind: completion.EventText, Text: text})
+	}
+	s.sent = len(ready)
+}
+
+// finish ends the edit once the model is done, when it is known whether the rest of
+// the line is still needed.
+func (s *eventStream) finish() {
+	s.done = true
+	s.body.Close()
+
+	inserted := strings.TrimRight(s.inserted.String(), " \t\r\n")
+	tail := s.window.tail(inserted)
+	if !s.started && (strings.TrimSpace(inserted) == "" || inserted+tail == s.window.after) {
+		s.logger.Debug("FIM model returned no usable completion", "raw", s.inserted.String())
+		s.events = append(s.events, completion.Event{Kind: completion.EventDoneStream})
+		return
+	}
+
+	s.emit(inserted)
+	if tail != "" {
+		s.events = append(s.events, completion.Event{Kind: completion.EventText, Text: tail})
+	}
+	s.events = append(s.events,
+		completion.Event{Kind: completion.EventDoneEdit},
+		completion.Event{Kind: completion.EventDoneStream},
+	)
+}
+
+func (s *eventStream) fail(err error) {
+	s.done = true
+	s.err = err
+	s.body.Close()
+}
+
+func (s *eventStream) Event() completion.Event {
+	return s.event
+}
+
+func (s *eventStream) Err() error {
+	return s.err
+}
+
+func (s *eventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,149 @@
+package fim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// sse renders tokens as the server-sent events of a streamed completion.
+func sse(tokens ...string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		data, _ := json.Marshal(map[string]any{"choices": []map[string]any{{"text": token}}})
+		fmt.Fprintf(&b, "data: %s\n\n", data)
+	}
+	b.WriteString("data: [DONE]\n\n")
+	return b.String()
+}
+
+// collect reads s to the end and joins the text of its single edit.
+func collect(t *testing.T, s *eventStream) (text string, edits int) {
+	t.Helper()
+	var b strings.Builder
+	for s.Receive() {
+		switch event := s.Event(); event.Kind {
+		case completion.EventRange:
+			if event.Range.StartLine != s.window.line+1 {
+				t.Errorf("range = %+v, want the cursor line", event.Range)
+			}
+		case completion.EventText:
+			b.WriteString(event.Text)
+		case completion.EventDoneEdit:
+			edits++
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String(), edits
+}
+
+func TestEventStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		tokens        []string
+		want          string
+	}{
+		{
+			name:   "insertion mid-line",
+			before: "\tfmt.Println(",
+			after:  ")",
+			tokens: []string{`"hello`, `"`},
+			want:   "\tfmt.Println(\"hello\")",
+		},
+		{
+			name:   "rest of the line retyped",
+			before: "\tfmt.Println(",
+			after:  ")",
+			tokens: []string{`"hello"`, ")"},
+			want:   "\tfmt.Println(\"hello\")",
+		},
+		{
+			name:   "trailing whitespace dropped",
+			before: "x := ",
+			tokens: []string{"1", "\n", "\n"},
+			want:   "x := 1",
+		},
+		{
+			name:   "whitespace kept between tokens",
+			before: "if ",
+			tokens: []string{"ok", " ", "{\n\t", "return"},
+			want:   "if ok {\n\treturn",
+		},
+		{
+			name:   "only the rest of the line",
+			before: "f(",
+			after:  ")",
+			tokens: []string{")"},
+		},
+		{
+			name:   "only whitespace",
+			before: "f(",
+			tokens: []string{" ", "\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := window{line: 4, before: tt.before, after: tt.after}
+			s := newEventStream(io.NopCloser(strings.NewReader(sse(tt.tokens...))), w, discardLogger)
+			text, edits := collect(t, s)
+			if tt.want == "" {
+				if edits != 0 {
+					t.Errorf("got edit %q, want none", text)
+				}
+				return
+			}
+			if edits != 1 || text != tt.want {
+				t.Errorf("edit = %q (%d edits), want %q", text, edits, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventStreamEmitsBeforeDone(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	s := newEventStream(r, window{before: "x := "}, discardLogger)
+
+	go io.WriteString(w, `data: {"choices":[{"text":"comp"}]}`+"\n\n")
+
+	var text strings.Builder
+	for text.String() != "x := comp" {
+		if !s.Receive() {
+			t.Fatalf("stream ended early: %v", s.Err())
+		}
+		text.WriteString(s.Event().Text)
+	}
+
+	go io.WriteString(w, `data: {"choices":[{"text":"uted"}]}`+"\n\n"+"data: [DONE]\n\n")
+	rest, edits := collect(t, s)
+	if text.String()+rest != "x := computed" || edits != 1 {
+		t.Errorf("edit = %q (%d edits), want %q", text.String()+rest, edits, "x := computed")
+	}
+}
+
+func TestEventStreamErrors(t *testing.T) {
+	for name, body := range map[string]string{
+		"bad chunk":    "data: {\n\n",
+		"server error": `data: {"error":{"message":"model not loaded"}}` + "\n\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newEventStream(io.NopCloser(strings.NewReader(body)), window{}, discardLogger)
+			for s.Receive() {
+			}
+			if s.Err() == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+}
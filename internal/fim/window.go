@@ -0,0 +1,80 @@
+package fim
+
+import (
+	"strings"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+// window is the text around the cursor that goes into the prompt, plus the parts of
+// the cursor line needed to turn the model's insertion into a line replacement.
+type window struct {
+	prefix string
+	suffix string
+
+	// line is the 0-indexed cursor line; before and after split it at the cursor.
+	line   int32
+	before string
+	after  string
+}
+
+func newWindow(req *completion.Request, prefixLines, suffixLines int) window {
+	lines := strings.Split(req.FileContents, "\n")
+
+	line := int(req.Line)
+	if line < 0 {
+		line = 0
+	}
+	if line >= len(lines) {
+		line = len(lines) - 1
+	}
+	current := lines[line]
+	column := int(req.Column)
+	if column < 0 {
+		column = 0
+	}
+	if column > len(current) {
+		column = len(current)
+	}
+
+	w := window{
+		line:   int32(line),
+		before: current[:column],
+		after:  current[column:],
+	}
+
+	first := line - prefixLines
+	if first < 0 {
+		first = 0
+	}
+	last := line + 1 + suffixLines
+	if last > len(lines) {
+		last = len(lines)
+	}
+
+	w.prefix = strings.Join(append(append([]string{}, lines[first:line]...), w.before), "\n")
+	w.suffix = strings.Join(append([]string{w.after}, lines[line+1:last]...), "\n")
+	return w
+}
+
+// editRange is the range an edit replaces: the cursor line, the shape the Cursor
+// backend produces.
+func (w window) editRange() *suggestionstore.RangeInfo {
+	return &suggestionstore.RangeInfo{
+		StartLine:   w.line + 1,
+		StartColumn: 0,
+		EndLine:     w.line + 1,
+		EndColumn:   -1,
+	}
+}
+
+// tail is the text that follows inserted on the replaced line. Models often
+// regenerate the rest of the line, e.g. a closing bracket that is already there, so
+// only one copy of it is kept.
+func (w window) tail(inserted string) string {
+	if rest := strings.TrimSpace(w.after); rest != "" && strings.HasSuffix(inserted, rest) {
+		return ""
+	}
+	return w.after
+}
@@ -0,0 +1,199 @@
+package index
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BM25 parameters, the common defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+const (
+	// chunkLines is the height of the line window each file is cut into, and
+	// chunkStride how far consecutive windows are apart, so they overlap by half.
+	chunkLines  = 30
+	chunkStride = 15
+)
+
+type chunk struct {
+	path       string
+	start, end int // 1-indexed, inclusive
+	// stamp is the file's at indexing, to tell whether its lines still hold the chunk.
+	stamp  stamp
+	length int
+	// terms are the chunk's distinct terms, to remove it from the postings.
+	terms []string
+}
+
+// bm25Index is an inverted index over line-window chunks that files can be added to
+// and removed from one at a time. It is safe for concurrent use.
+type bm25Index struct {
+	mu          sync.RWMutex
+	chunks      map[int]*chunk
+	files       map[string][]int
+	postings    map[string]map[int]int32
+	totalLength int
+	nextID      int
+}
+
+func newBM25Index() *bm25Index {
+	return &bm25Index{
+		chunks:   make(map[int]*chunk),
+		files:    make(map[string][]int),
+		postings: make(map[string]map[int]int32),
+	}
+}
+
+// scored is a search hit before its content is read.
+type scored struct {
+	path       string
+	start, end int
+	stamp      stamp
+	score      float64
+}
+
+// setFile replaces the chunks of path with those of contents, read from the file at
+// stamp.
+func (x *bm25Index) setFile(path, contents string, st stamp) {
+	type pending struct {
+		chunk *chunk
+		freqs map[string]int32
+	}
+	var chunks []pending
+	lines := strings.Split(contents, "\n")
+	for start := 0; start < len(lines); start += chunkStride {
+		end := min(start+chunkLines, len(lines))
+		freqs := make(map[string]int32)
+		length := 0
+		for _, term := range tokenize(strings.Join(lines[start:end], "\n")) {
+			freqs[term]++
+			length++
+		}
+		if length > 0 {
+			c := &chunk{path: path, start: start + 1, end: end, stamp: st, length: length}
+			for term := range freqs {
+				c.terms = append(c.terms, term)
+			}
+			chunks = append(chunks, pending{c, freqs})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(path)
+	var ids []int
+	for _, p := range chunks {
+		id := x.nextID
+		x.nextID++
+		x.chunks[id] = p.chunk
+		x.totalLength += p.chunk.length
+		for term, freq := range p.freqs {
+			posting := x.postings[term]
+			if posting == nil {
+				posting = make(map[int]int32)
+				x.postings[term] = posting
+			}
+			posting[id] = freq
+		}
+		ids = append(ids, id)
+	}
+	x.files[path] = ids
+}
+
+func (x *bm25Index) removeFile(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(path)
+}
+
+func (x *bm25Index) removeLocked(path string) {
+	for _, id := range x.files[path] {
+		c := x.chunks[id]
+		for _, term := range c.terms {
+			posting := x.postings[term]
+			delete(posting, id)
+			if len(posting) == 0 {
+				delete(x.postings, term)
+			}
+		}
+		x.totalLength -= c.length
+		delete(x.chunks, id)
+	}
+	delete(x.files, path)
+}
+
+// search returns the k best chunks for query outside exclude, best first.
+func (x *bm25Index) search(query, exclude string, k int) []scored {
+	terms := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		terms[term] = true
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if len(x.chunks) == 0 {
+		return nil
+	}
+
+	n := float64(len(x.chunks))
+	avgLength := float64(x.totalLength) / n
+	scores := make(map[int]float64)
+	for term := range terms {
+		posting := x.postings[term]
+		if len(posting) == 0 {
+			continue
+		}
+		df := float64(len(posting))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, freq := range posting {
+			tf := float64(freq)
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(x.chunks[id].length)/avgLength)
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+	}
+
+	var hits []scored
+	for id, score := range scores {
+		c := x.chunks[id]
+		if c.path == exclude {
+			continue
+		}
+		hits = append(hits, scored{path: c.path, start: c.start, end: c.end, stamp: c.stamp, score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		if hits[i].path != hits[j].path {
+			return hits[i].path < hits[j].path
+		}
+		return hits[i].start < hits[j].start
+	})
+
+	// Overlapping windows of the same region tend to score alike; keep the best one.
+	var top []scored
+	for _, hit := range hits {
+		if len(top) == k {
+			break
+		}
+		overlaps := false
+		for _, t := range top {
+			if t.path == hit.path && t.start <= hit.end && hit.start <= t.end {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			top = append(top, hit)
+		}
+	}
+	return top
+}
@@ -0,0 +1,75 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBM25Search(t *testing.T) {
+	x := newBM25Index()
+	x.setFile("server.go", "func parseRequest(r *http.Request) {}\n", stamp{})
+	x.setFile("client.go", "func sendRequest() {}\nfunc retry() {}\n", stamp{})
+	x.setFile("util.go", "func clamp(v int) int { return v }\n", stamp{})
+
+	hits := x.search("parseRequest", "", 5)
+	if len(hits) != 2 || hits[0].path != "server.go" || hits[1].path != "client.go" {
+		t.Fatalf("hits = %+v, want server.go then client.go", hits)
+	}
+	if hits[0].score <= hits[1].score {
+		t.Errorf("scores = %v, %v, want the exact identifier to score higher", hits[0].score, hits[1].score)
+	}
+
+	if hits := x.search("parseRequest", "server.go", 5); len(hits) != 1 || hits[0].path != "client.go" {
+		t.Errorf("hits excluding server.go = %+v, want client.go only", hits)
+	}
+	if hits := x.search("parseRequest", "", 1); len(hits) != 1 {
+		t.Errorf("got %d hits, want k=1", len(hits))
+	}
+	if hits := x.search("nothing matches", "", 5); len(hits) != 0 {
+		t.Errorf("hits = %+v, want none", hits)
+	}
+}
+
+func TestBM25Chunks(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 40; i++ {
+		lines = append(lines, fmt.Sprintf("line%d", i))
+	}
+	lines[19] = "needle"
+	x := newBM25Index()
+	x.setFile("long.go", strings.Join(lines, "\n"), stamp{size: 1})
+
+	if got := len(x.files["long.go"]); got != 2 {
+		t.Fatalf("got %d chunks, want 2 for 40 lines", got)
+	}
+	// Line 20 is in both overlapping windows; only the better one is returned.
+	hits := x.search("needle", "", 5)
+	if len(hits) != 1 {
+		t.Fatalf("hits = %+v, want one", hits)
+	}
+	if hit := hits[0]; hit.start > 20 || hit.end < 20 || hit.stamp != (stamp{size: 1}) {
+		t.Errorf("hit = %+v, want a window around line 20 with the file's stamp", hit)
+	}
+}
+
+func TestBM25SetFileReplaces(t *testing.T) {
+	x := newBM25Index()
+	x.setFile("a.go", "alpha beta", stamp{})
+	x.setFile("b.go", "beta gamma", stamp{})
+	x.setFile("a.go", "delta", stamp{})
+
+	if hits := x.search("alpha", "", 5); len(hits) != 0 {
+		t.Errorf("hits for replaced text = %+v, want none", hits)
+	}
+	if hits := x.search("delta", "", 5); len(hits) != 1 || hits[0].path != "a.go" {
+		t.Errorf("hits for new text = %+v, want a.go", hits)
+	}
+
+	x.removeFile("a.go")
+	x.removeFile("b.go")
+	if len(x.chunks) != 0 || len(x.postings) != 0 || len(x.files) != 0 || x.totalLength != 0 {
+		t.Errorf("index after removing everything = %d chunks, %d terms, %d files, length %d",
+			len(x.chunks), len(x.postings), len(x.files), x.totalLength)
+	}
+}
@@ -0,0 +1,129 @@
+package index
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreRule is one line of a .gitignore file.
+type ignoreRule struct {
+	// base is the directory of the .gitignore file, relative to the root, "" for the root.
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	// anchored rules match from base; others match a name at any depth below it.
+	anchored bool
+}
+
+// ignorer holds the .gitignore rules that apply to the directory being walked.
+// Later rules take precedence, as in git.
+type ignorer struct {
+	rules []ignoreRule
+}
+
+// withFile returns an ignorer that also applies the .gitignore at file, which lives in
+// dir (relative to the root). A missing file leaves the rules unchanged.
+func (ig *ignorer) withFile(file, dir string) *ignorer {
+	f, err := os.Open(file)
+	if err != nil {
+		return ig
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text(), dir); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return ig
+	}
+	return &ignorer{rules: append(append([]ignoreRule(nil), ig.rules...), rules...)}
+}
+
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// ignored reports whether rel, a slash-separated path relative to the root, is
+// excluded. Its parent directories are assumed not to be.
+func (ig *ignorer) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.matches(rel) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) matches(rel string) bool {
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if !r.anchored {
+		return matchSegments(r.segments, []string{path.Base(rel)})
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches glob segments against path segments, with "**" standing for
+// any number of directories.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
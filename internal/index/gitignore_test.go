@@ -0,0 +1,56 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnorer(t *testing.T) {
+	tests := []struct {
+		name      string
+		gitignore string
+		// base is the directory the .gitignore is in, relative to the root.
+		base  string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{name: "name at any depth", gitignore: "*.log", path: "a/b/debug.log", want: true},
+		{name: "other extension", gitignore: "*.log", path: "a/b/debug.txt"},
+		{name: "comment and blank lines", gitignore: "# *.go\n\n", path: "main.go"},
+		{name: "directory only matches directories", gitignore: "build/", path: "build"},
+		{name: "directory", gitignore: "build/", path: "build", isDir: true, want: true},
+		{name: "anchored", gitignore: "/vendor", path: "vendor", isDir: true, want: true},
+		{name: "anchored not below", gitignore: "/vendor", path: "lib/vendor", isDir: true},
+		{name: "path with slash is anchored", gitignore: "docs/gen", path: "docs/gen", isDir: true, want: true},
+		{name: "double star", gitignore: "**/testdata/*.bin", path: "a/b/testdata/x.bin", want: true},
+		{name: "trailing double star", gitignore: "out/**", path: "out/a/b.js", want: true},
+		{name: "negation", gitignore: "*.log\n!keep.log", path: "keep.log"},
+		{name: "later rule wins", gitignore: "!keep.log\n*.log", path: "keep.log", want: true},
+		{name: "escaped hash", gitignore: `\#notes`, path: "#notes", want: true},
+		{name: "nested file applies below it", gitignore: "*.tmp", base: "sub", path: "sub/x.tmp", want: true},
+		{name: "nested file not above it", gitignore: "*.tmp", base: "sub", path: "x.tmp"},
+		{name: "nested anchored", gitignore: "/gen", base: "sub", path: "sub/gen", isDir: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), ".gitignore")
+			if err := os.WriteFile(file, []byte(tt.gitignore), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			ig := (&ignorer{}).withFile(file, tt.base)
+			if got := ig.ignored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("ignored(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnorerMissingFile(t *testing.T) {
+	ig := &ignorer{}
+	if got := ig.withFile(filepath.Join(t.TempDir(), ".gitignore"), ""); got != ig {
+		t.Error("a missing .gitignore should leave the rules unchanged")
+	}
+}
@@ -0,0 +1,301 @@
+// Package index keeps a local BM25 index of each workspace the editor works in, so
+// requests can carry code related to what is around the cursor. Nothing leaves the
+// machine; files are read from disk and rescanned when they change.
+package index
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for Options fields left zero.
+const (
+	DefaultMaxFiles       = 20000
+	DefaultMaxFileBytes   = 256 << 10
+	DefaultRescanInterval = 30 * time.Second
+	DefaultTopChunks      = 5
+	DefaultMaxWorkspaces  = 4
+)
+
+// Options bounds the indexing work.
+type Options struct {
+	// MaxFiles stops a workspace scan after this many files, e.g. when the editor was
+	// started in the home directory.
+	MaxFiles int
+	// MaxFileBytes skips larger files, which are mostly generated or data.
+	MaxFileBytes int
+	// RescanInterval is how often a workspace is checked for changed files.
+	RescanInterval time.Duration
+	// TopChunks is how many chunks Search returns.
+	TopChunks int
+	// MaxWorkspaces bounds how many workspaces are indexed; the least recently
+	// searched one is dropped.
+	MaxWorkspaces int
+
+	Logger *slog.Logger
+}
+
+// Chunk is a window of lines from a workspace file that matched a query.
+type Chunk struct {
+	// Path is absolute, like the file paths the editor sends.
+	Path      string
+	StartLine int // 1-indexed
+	EndLine   int // inclusive
+	Content   string
+	Score     float64
+}
+
+// Manager indexes workspaces on first use and keeps them up to date in the
+// background. It is safe for concurrent use.
+type Manager struct {
+	opts Options
+
+	mu         sync.Mutex
+	workspaces map[string]*workspace
+}
+
+type workspace struct {
+	root     string
+	index    *bm25Index
+	cancel   context.CancelFunc
+	lastUsed time.Time
+
+	// stamps are the modification time and size each file was indexed at. They are
+	// only used by the scan goroutine.
+	stamps  map[string]stamp
+	limited bool
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func NewManager(opts Options) *Manager {
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DefaultMaxFiles
+	}
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = DefaultMaxFileBytes
+	}
+	if opts.RescanInterval <= 0 {
+		opts.RescanInterval = DefaultRescanInterval
+	}
+	if opts.TopChunks <= 0 {
+		opts.TopChunks = DefaultTopChunks
+	}
+	if opts.MaxWorkspaces <= 0 {
+		opts.MaxWorkspaces = DefaultMaxWorkspaces
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &Manager{opts: opts, workspaces: make(map[string]*workspace)}
+}
+
+// Search returns the chunks of root that best match query, leaving out the file at
+// exclude. The first search in a workspace starts indexing it and returns nothing;
+// later ones see whatever has been indexed so far.
+func (m *Manager) Search(root, exclude, query string) []Chunk {
+	if !filepath.IsAbs(root) {
+		return nil
+	}
+	ws := m.workspace(filepath.Clean(root))
+
+	excludeRel := ""
+	if rel, err := filepath.Rel(ws.root, exclude); err == nil {
+		excludeRel = filepath.ToSlash(rel)
+	}
+
+	var chunks []Chunk
+	for _, hit := range ws.index.search(query, excludeRel, m.opts.TopChunks) {
+		file := filepath.Join(ws.root, filepath.FromSlash(hit.path))
+		// A file changed since it was indexed no longer has the chunk at these lines;
+		// it is skipped until the next scan reindexes it.
+		content, ok := readLines(file, hit.start, hit.end, hit.stamp)
+		if !ok {
+			continue
+		}
+		chunks = append(chunks, Chunk{
+			Path:      file,
+			StartLine: hit.start,
+			EndLine:   hit.end,
+			Content:   content,
+			Score:     hit.score,
+		})
+	}
+	return chunks
+}
+
+// Close stops all background scans.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for root, ws := range m.workspaces {
+		ws.cancel()
+		delete(m.workspaces, root)
+	}
+}
+
+func (m *Manager) workspace(root string) *workspace {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ws, ok := m.workspaces[root]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		ws = &workspace{root: root, index: newBM25Index(), cancel: cancel, stamps: make(map[string]stamp)}
+		m.workspaces[root] = ws
+		go m.run(ctx, ws)
+
+		for len(m.workspaces) > m.opts.MaxWorkspaces {
+			var oldest *workspace
+			for _, candidate := range m.workspaces {
+				if oldest == nil || candidate.lastUsed.Before(oldest.lastUsed) {
+					oldest = candidate
+				}
+			}
+			oldest.cancel()
+			delete(m.workspaces, oldest.root)
+			m.opts.Logger.Info("Dropped workspace index", "workspace", oldest.root)
+		}
+	}
+	ws.lastUsed = time.Now()
+	return ws
+}
+
+func (m *Manager) run(ctx context.Context, ws *workspace) {
+	ticker := time.NewTicker(m.opts.RescanInterval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		indexed, removed := m.scan(ctx, ws)
+		if ctx.Err() != nil {
+			return
+		}
+		if indexed > 0 || removed > 0 {
+			m.opts.Logger.Info("Indexed workspace", "workspace", ws.root, "files", len(ws.stamps),
+				"indexed", indexed, "removed", removed, "duration", time.Since(start))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scan walks the workspace, reindexing files whose modification time or size
+// changed and dropping files that are gone.
+func (m *Manager) scan(ctx context.Context, ws *workspace) (indexed, removed int) {
+	seen := make(map[string]bool)
+	count := 0
+	limited := false
+
+	var walk func(dir, rel string, ig *ignorer)
+	walk = func(dir, rel string, ig *ignorer) {
+		ig = ig.withFile(filepath.Join(dir, ".gitignore"), rel)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if ctx.Err() != nil || limited {
+				return
+			}
+			name := entry.Name()
+			entryRel := path.Join(rel, name)
+			// Symlinks are skipped; they can loop or leave the workspace.
+			if name == ".git" || entry.Type()&fs.ModeSymlink != 0 || ig.ignored(entryRel, entry.IsDir()) {
+				continue
+			}
+			if entry.IsDir() {
+				walk(filepath.Join(dir, name), entryRel, ig)
+				continue
+			}
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			if count >= m.opts.MaxFiles {
+				limited = true
+				return
+			}
+			count++
+
+			info, err := entry.Info()
+			if err != nil || info.Size() > int64(m.opts.MaxFileBytes) {
+				continue
+			}
+			seen[entryRel] = true
+			current := stamp{modTime: info.ModTime(), size: info.Size()}
+			if previous, ok := ws.stamps[entryRel]; ok && previous == current {
+				continue
+			}
+			ws.stamps[entryRel] = current
+			contents, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil || isBinary(contents) {
+				ws.index.removeFile(entryRel)
+				continue
+			}
+			ws.index.setFile(entryRel, string(contents), current)
+			indexed++
+		}
+	}
+	walk(ws.root, "", &ignorer{})
+	if ctx.Err() != nil {
+		return indexed, removed
+	}
+
+	if limited && !ws.limited {
+		m.opts.Logger.Warn("Workspace has too many files, indexing only part of it",
+			"workspace", ws.root, "max_files", m.opts.MaxFiles)
+	}
+	ws.limited = limited
+	for rel := range ws.stamps {
+		if !seen[rel] {
+			delete(ws.stamps, rel)
+			ws.index.removeFile(rel)
+			removed++
+		}
+	}
+	return indexed, removed
+}
+
+// isBinary applies git's heuristic: a NUL byte near the start.
+func isBinary(contents []byte) bool {
+	return bytes.IndexByte(contents[:min(len(contents), 8000)], 0) >= 0
+}
+
+// readLines reads lines start to end (1-indexed, inclusive) of a file, provided it
+// is still at want.
+func readLines(file string, start, end int, want stamp) (string, bool) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || (stamp{modTime: info.ModTime(), size: info.Size()}) != want {
+		return "", false
+	}
+	contents, err := io.ReadAll(f)
+	if err != nil {
+		return "", false
+	}
+	lines := strings.Split(string(contents), "\n")
+	if start > len(lines) {
+		return "", false
+	}
+	return strings.Join(lines[start-1:min(end, len(lines))], "\n"), true
+}
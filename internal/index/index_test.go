@@ -0,0 +1,34 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadLinesSkipsChangedFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(file, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed := stamp{modTime: info.ModTime(), size: info.Size()}
+
+	if got, ok := readLines(file, 2, 3, indexed); !ok || got != "two\nthree" {
+		t.Errorf("readLines = %q, %v, want lines 2-3", got, ok)
+	}
+
+	if err := os.WriteFile(file, []byte("inserted\none\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, time.Now(), info.ModTime().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := readLines(file, 2, 3, indexed); ok {
+		t.Errorf("readLines after a change = %q, want it skipped", got)
+	}
+}
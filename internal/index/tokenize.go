@@ -0,0 +1,60 @@
+package index
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	minTokenLength = 2
+	maxTokenLength = 64
+)
+
+// tokenize splits source text into lower-case terms. Identifiers are kept whole and
+// also split at camelCase and snake_case boundaries, so "parseHTTPRequest" matches
+// queries for "parse", "http" and "request".
+func tokenize(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		parts := splitIdentifier(word)
+		if len(parts) > 1 {
+			terms = appendTerm(terms, word)
+		}
+		for _, part := range parts {
+			terms = appendTerm(terms, part)
+		}
+	}
+	return terms
+}
+
+func appendTerm(terms []string, term string) []string {
+	if len(term) < minTokenLength || len(term) > maxTokenLength {
+		return terms
+	}
+	return append(terms, strings.ToLower(term))
+}
+
+// splitIdentifier splits at underscores and at lower-to-upper and acronym-to-word
+// case changes.
+func splitIdentifier(word string) []string {
+	var parts []string
+	for _, piece := range strings.Split(word, "_") {
+		runes := []rune(piece)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+			acronymEnd := unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) &&
+				i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if lowerToUpper || acronymEnd {
+				parts = append(parts, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, string(runes[start:]))
+		}
+	}
+	return parts
+}
@@ -0,0 +1,53 @@
+package shadow
+
+import "unicode/utf8"
+
+// maxCompareRunes caps the texts compared, keeping the quadratic distance cheap for
+// the occasional huge suggestion.
+const maxCompareRunes = 4000
+
+// levenshtein returns the edit distance between a and b in runes.
+func levenshtein(a, b string) int {
+	ra, rb := truncate(a), truncate(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func truncate(s string) []rune {
+	r := []rune(s)
+	if len(r) > maxCompareRunes {
+		r = r[:maxCompareRunes]
+	}
+	return r
+}
+
+// similarity is 1 for identical texts and 0 when nothing is shared.
+func similarity(a, b string, distance int) float64 {
+	longest := max(utf8.RuneCountInString(a), utf8.RuneCountInString(b))
+	if longest > maxCompareRunes {
+		longest = maxCompareRunes
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(distance)/float64(longest)
+}
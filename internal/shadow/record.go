@@ -0,0 +1,84 @@
+package shadow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+// DefaultLogFile is where shadow records go unless configured otherwise.
+const DefaultLogFile = "/tmp/cursor-tab-shadow.jsonl"
+
+// Result is one backend's first edit for a request. Text is empty when the backend
+// had no suggestion.
+type Result struct {
+	Backend   string                     `json:"backend"`
+	Text      string                     `json:"text"`
+	Range     *suggestionstore.RangeInfo `json:"range,omitempty"`
+	LatencyMs int64                      `json:"latency_ms"`
+	Error     string                     `json:"error,omitempty"`
+}
+
+// Record is one line of the shadow log.
+type Record struct {
+	Time       time.Time `json:"time"`
+	FilePath   string    `json:"file_path"`
+	LanguageID string    `json:"language_id"`
+	Line       int32     `json:"line"`
+	Column     int32     `json:"column"`
+	Primary    Result    `json:"primary"`
+	Secondary  Result    `json:"secondary"`
+	// EditDistance is the Levenshtein distance between the two texts in characters,
+	// and Similarity normalizes it to 0..1 by the longer text.
+	EditDistance int     `json:"edit_distance"`
+	Similarity   float64 `json:"similarity"`
+	ExactMatch   bool    `json:"exact_match"`
+}
+
+func newRecord(req *completion.Request, primary, secondary Result) Record {
+	a, b := strings.TrimSpace(primary.Text), strings.TrimSpace(secondary.Text)
+	distance := levenshtein(a, b)
+	return Record{
+		Time:         time.Now(),
+		FilePath:     req.FilePath,
+		LanguageID:   req.LanguageID,
+		Line:         req.Line,
+		Column:       req.Column,
+		Primary:      primary,
+		Secondary:    secondary,
+		EditDistance: distance,
+		Similarity:   similarity(a, b, distance),
+		ExactMatch:   a == b,
+	}
+}
+
+// Recorder appends records to a JSONL file.
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func OpenRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening shadow log: %w", err)
+	}
+	return &Recorder{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (r *Recorder) Write(record Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(record)
+}
+
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
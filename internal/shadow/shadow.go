@@ -0,0 +1,189 @@
+// Package shadow runs a secondary completion backend alongside the primary one
+// without ever showing its output, and records both answers for comparison.
+package shadow
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bengu3/cursor-tab.nvim/internal/completion"
+	"github.com/bengu3/cursor-tab.nvim/internal/suggestionstore"
+)
+
+// DefaultTimeout bounds how long a shadow comparison waits for either backend.
+const DefaultTimeout = 30 * time.Second
+
+// Completer serves every request from the primary backend and, in the background,
+// sends it to the secondary backend as well. Each pair of first edits is written to
+// the recorder.
+type Completer struct {
+	primary   completion.Completer
+	secondary completion.Completer
+	recorder  *Recorder
+	timeout   time.Duration
+	logger    *slog.Logger
+}
+
+func New(primary, secondary completion.Completer, recorder *Recorder, timeout time.Duration, logger *slog.Logger) *Completer {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &Completer{primary: primary, secondary: secondary, recorder: recorder, timeout: timeout, logger: logger}
+}
+
+// Name implements completion.Completer. Shadowing is invisible, so this is the
+// primary's name.
+func (c *Completer) Name() string {
+	return c.primary.Name()
+}
+
+// Primary returns the backend whose answers are served.
+func (c *Completer) Primary() completion.Completer {
+	return c.primary
+}
+
+// Complete implements completion.Completer.
+func (c *Completer) Complete(ctx context.Context, req *completion.Request) (completion.Stream, error) {
+	start := time.Now()
+	primaryDone := make(chan Result, 1)
+	go c.compare(ctx, req, start, primaryDone)
+
+	stream, err := c.primary.Complete(ctx, req)
+	if err != nil {
+		primaryDone <- Result{Backend: c.primary.Name(), LatencyMs: time.Since(start).Milliseconds(), Error: err.Error()}
+		return nil, err
+	}
+	return &teeStream{Stream: stream, backend: c.primary.Name(), start: start, done: primaryDone}, nil
+}
+
+// compare runs the secondary backend, waits for the primary's first edit and records
+// both. It outlives the HTTP request, since the editor often cancels a request as
+// soon as the user types on.
+func (c *Completer) compare(ctx context.Context, req *completion.Request, start time.Time, primaryDone <-chan Result) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	secondary := c.runSecondary(ctx, req, start)
+
+	var primary Result
+	select {
+	case primary = <-primaryDone:
+	case <-ctx.Done():
+		primary = Result{Backend: c.primary.Name(), Error: "no answer within the shadow timeout"}
+	}
+
+	record := newRecord(req, primary, secondary)
+	if err := c.recorder.Write(record); err != nil {
+		c.logger.Error("Failed to write shadow record", "error", err)
+	}
+	c.logger.Debug("Shadow comparison",
+		"primary", primary.Backend,
+		"secondary", secondary.Backend,
+		"primary_latency_ms", primary.LatencyMs,
+		"secondary_latency_ms", secondary.LatencyMs,
+		"edit_distance", record.EditDistance)
+}
+
+func (c *Completer) runSecondary(ctx context.Context, req *completion.Request, start time.Time) Result {
+	result := Result{Backend: c.secondary.Name()}
+
+	stream, err := c.secondary.Complete(ctx, req)
+	if err != nil {
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.Error = err.Error()
+		return result
+	}
+	defer stream.Close()
+
+	var edit firstEdit
+	for stream.Receive() {
+		if edit.add(stream.Event()) {
+			break
+		}
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Text, result.Range = edit.text, edit.rng
+	if err := stream.Err(); err != nil && !edit.complete {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// firstEdit accumulates events until the end of the first edit with any content.
+type firstEdit struct {
+	text       string
+	rng        *suggestionstore.RangeInfo
+	hasContent bool
+	complete   bool
+}
+
+// add feeds one event and reports whether the first edit is complete.
+func (e *firstEdit) add(event completion.Event) bool {
+	if e.complete {
+		return true
+	}
+	switch event.Kind {
+	case completion.EventBeginEdit:
+		e.text, e.rng, e.hasContent = "", nil, false
+	case completion.EventRange:
+		e.rng, e.hasContent = event.Range, true
+	case completion.EventText:
+		e.text += event.Text
+		e.hasContent = e.hasContent || event.Text != ""
+	case completion.EventDoneEdit:
+		e.complete = e.hasContent
+	case completion.EventDoneStream:
+		e.text, e.rng = "", nil
+		return true
+	}
+	return e.complete
+}
+
+// teeStream passes the primary's events through unchanged and reports its first
+// edit for comparison.
+type teeStream struct {
+	completion.Stream
+	backend string
+	start   time.Time
+	done    chan<- Result
+
+	edit firstEdit
+	once sync.Once
+}
+
+func (s *teeStream) Receive() bool {
+	if !s.Stream.Receive() {
+		s.report()
+		return false
+	}
+	if s.edit.add(s.Stream.Event()) {
+		s.report()
+	}
+	return true
+}
+
+func (s *teeStream) report() {
+	s.once.Do(func() {
+		result := Result{
+			Backend:   s.backend,
+			LatencyMs: time.Since(s.start).Milliseconds(),
+		}
+		if s.edit.complete {
+			result.Text, result.Range = s.edit.text, s.edit.rng
+		} else if err := s.Stream.Err(); err != nil {
+			result.Error = err.Error()
+		}
+		s.done <- result
+	})
+}
+
+func (s *teeStream) Close() error {
+	s.report()
+	return s.Stream.Close()
+}
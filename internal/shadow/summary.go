@@ -0,0 +1,153 @@
+package shadow
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// CloseSimilarity is the similarity at or above which two suggestions count as
+// agreeing even if they are not identical.
+const CloseSimilarity = 0.8
+
+// Summary aggregates a shadow log.
+type Summary struct {
+	Records          int
+	PrimaryBackend   string
+	SecondaryBackend string
+
+	// Of all records: which side had a suggestion.
+	BothSuggested int
+	PrimaryOnly   int
+	SecondaryOnly int
+	Neither       int
+
+	// Of the records where both suggested something.
+	ExactMatches   int
+	CloseMatches   int
+	MeanSimilarity float64
+
+	PrimaryErrors    int
+	SecondaryErrors  int
+	PrimaryLatency   LatencySummary
+	SecondaryLatency LatencySummary
+}
+
+// LatencySummary describes the latencies of answers that did not fail.
+type LatencySummary struct {
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+}
+
+// Summarize reads a shadow log. Lines that fail to parse are skipped, so a log cut
+// off mid-write still summarizes.
+func Summarize(r io.Reader) (*Summary, error) {
+	s := &Summary{}
+	var primaryLatencies, secondaryLatencies []time.Duration
+	var similaritySum float64
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		s.Records++
+		s.PrimaryBackend = record.Primary.Backend
+		s.SecondaryBackend = record.Secondary.Backend
+
+		primary, secondary := record.Primary.Text != "", record.Secondary.Text != ""
+		switch {
+		case primary && secondary:
+			s.BothSuggested++
+			similaritySum += record.Similarity
+			if record.ExactMatch {
+				s.ExactMatches++
+			}
+			if record.Similarity >= CloseSimilarity {
+				s.CloseMatches++
+			}
+		case primary:
+			s.PrimaryOnly++
+		case secondary:
+			s.SecondaryOnly++
+		default:
+			s.Neither++
+		}
+
+		if record.Primary.Error != "" {
+			s.PrimaryErrors++
+		} else {
+			primaryLatencies = append(primaryLatencies, time.Duration(record.Primary.LatencyMs)*time.Millisecond)
+		}
+		if record.Secondary.Error != "" {
+			s.SecondaryErrors++
+		} else {
+			secondaryLatencies = append(secondaryLatencies, time.Duration(record.Secondary.LatencyMs)*time.Millisecond)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading shadow log: %w", err)
+	}
+
+	if s.BothSuggested > 0 {
+		s.MeanSimilarity = similaritySum / float64(s.BothSuggested)
+	}
+	s.PrimaryLatency = summarizeLatencies(primaryLatencies)
+	s.SecondaryLatency = summarizeLatencies(secondaryLatencies)
+	return s, nil
+}
+
+func summarizeLatencies(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	return LatencySummary{
+		Count: len(latencies),
+		Mean:  total / time.Duration(len(latencies)),
+		P50:   latencies[len(latencies)*50/100],
+		P90:   latencies[len(latencies)*90/100],
+	}
+}
+
+// Print writes a human-readable report.
+func (s *Summary) Print(w io.Writer) {
+	pct := func(n, of int) string {
+		if of == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(of))
+	}
+
+	fmt.Fprintf(w, "records:            %d (primary %s, secondary %s)\n", s.Records, s.PrimaryBackend, s.SecondaryBackend)
+	fmt.Fprintf(w, "both suggested:     %d (%s)\n", s.BothSuggested, pct(s.BothSuggested, s.Records))
+	fmt.Fprintf(w, "primary only:       %d (%s)\n", s.PrimaryOnly, pct(s.PrimaryOnly, s.Records))
+	fmt.Fprintf(w, "secondary only:     %d (%s)\n", s.SecondaryOnly, pct(s.SecondaryOnly, s.Records))
+	fmt.Fprintf(w, "neither:            %d (%s)\n", s.Neither, pct(s.Neither, s.Records))
+	fmt.Fprintf(w, "exact agreement:    %s of both suggested\n", pct(s.ExactMatches, s.BothSuggested))
+	fmt.Fprintf(w, "close agreement:    %s of both suggested (similarity >= %.1f)\n", pct(s.CloseMatches, s.BothSuggested), CloseSimilarity)
+	fmt.Fprintf(w, "mean similarity:    %.2f\n", s.MeanSimilarity)
+	fmt.Fprintf(w, "errors:             primary %d, secondary %d\n", s.PrimaryErrors, s.SecondaryErrors)
+	printLatency(w, "primary latency:   ", s.PrimaryLatency)
+	printLatency(w, "secondary latency: ", s.SecondaryLatency)
+}
+
+func printLatency(w io.Writer, label string, l LatencySummary) {
+	if l.Count == 0 {
+		fmt.Fprintf(w, "%s -\n", label)
+		return
+	}
+	fmt.Fprintf(w, "%s mean %s, p50 %s, p90 %s\n", label, l.Mean, l.P50, l.P90)
+}
@@ -10,12 +10,21 @@ M.server_url = nil
 M.server_port = nil
 M.server_ready = false
 M.server_path = nil
+M.server_args = {}
 M.server_job = nil
 M.debounce_timer = nil
 M.debounce_time_ms = 150
 M.enabled = true
 M.pending_job = nil
 M.next_suggestion_id = nil
+M.document_sync = true
+M.send_diagnostics = true
+M.report_buffers = true
+M.buffers_timer = nil
+-- Synced buffers by bufnr: { file_path, workspace_path, version, pending, needs_open, syncing, waiters }
+M.documents = {}
+-- Beyond this many queued edits a buffer is re-sent in full instead.
+M.max_pending_changes = 200
 
 function M.setup(opts)
 	opts = opts or {}
@@ -35,6 +44,16 @@ function M.setup(opts)
 	else
 		M.server_path = opts.server_path
 	end
+	M.server_args = opts.server_args or {}
+	if opts.document_sync ~= nil then
+		M.document_sync = opts.document_sync
+	end
+	if opts.send_diagnostics ~= nil then
+		M.send_diagnostics = opts.send_diagnostics
+	end
+	if opts.report_buffers ~= nil then
+		M.report_buffers = opts.report_buffers
+	end
 
 	M.ensure_server()
 
@@ -60,6 +79,35 @@ function M.setup(opts)
 		end,
 	})
 
+	if M.report_buffers then
+		vim.api.nvim_create_autocmd({ "BufEnter", "WinScrolled", "BufDelete" }, {
+			callback = function()
+				M.schedule_buffers_report()
+			end,
+		})
+	end
+
+	if M.document_sync then
+		vim.api.nvim_create_autocmd({ "BufEnter" }, {
+			callback = function(args)
+				M.attach_document(args.buf)
+			end,
+		})
+
+		vim.api.nvim_create_autocmd({ "BufUnload" }, {
+			callback = function(args)
+				M.close_document(args.buf)
+			end,
+		})
+
+		vim.api.nvim_create_autocmd({ "BufFilePost" }, {
+			callback = function(args)
+				M.close_document(args.buf)
+				M.attach_document(args.buf)
+			end,
+		})
+	end
+
 	vim.keymap.set("i", "<Tab>", function()
 		if M.accept_suggestion() then
 			return ""
@@ -84,13 +132,15 @@ function M.setup(opts)
 			M.enabled = false
 			M.clear_suggestion()
 			vim.notify("CursorTab disabled", vim.log.levels.INFO)
+		elseif args.args == "status" then
+			M.show_status()
 		else
-			vim.notify("Usage: :CursorTab [toggle|enable|disable]", vim.log.levels.ERROR)
+			vim.notify("Usage: :CursorTab [toggle|enable|disable|status]", vim.log.levels.ERROR)
 		end
 	end, {
 		nargs = 1,
 		complete = function()
-			return { "toggle", "enable", "disable" }
+			return { "toggle", "enable", "disable", "status" }
 		end,
 	})
 
@@ -123,7 +173,10 @@ function M.ensure_server()
 	M.server_port = nil
 	M.server_url = nil
 
-	M.server_job = vim.fn.jobstart({ M.server_path, "--port", "0" }, {
+	local cmd = { M.server_path, "--port", "0" }
+	vim.list_extend(cmd, M.server_args)
+
+	M.server_job = vim.fn.jobstart(cmd, {
 		on_stdout = function(_, data)
 			if data and #data > 0 then
 				for _, line in ipairs(data) do
@@ -145,6 +198,10 @@ function M.ensure_server()
 			M.server_ready = false
 			M.server_port = nil
 			M.server_url = nil
+			-- A new server starts without documents
+			for _, doc in pairs(M.documents) do
+				doc.needs_open = true
+			end
 		end,
 		on_stderr = function(_, data)
 			if data and #data > 0 and data[1] ~= "" then
@@ -164,6 +221,291 @@ function M.ensure_server()
 	return true
 end
 
+function M.format_race(race)
+	local lines = {}
+	for _, backend in ipairs(race) do
+		table.insert(
+			lines,
+			backend.name
+				.. ": won "
+				.. backend.wins
+				.. "/"
+				.. backend.requests
+				.. ", avg latency "
+				.. (backend.avg_latency or "-")
+		)
+	end
+	return table.concat(lines, "\n")
+end
+
+function M.format_status(status)
+	if status.backend and not status.backend:find("cursor", 1, true) then
+		local msg = "cursor-tab: using the " .. status.backend .. " backend"
+		if status.race then
+			msg = msg .. "\n" .. M.format_race(status.race)
+		end
+		return msg
+	end
+	if not status.initialized then
+		local client = status.client or {}
+		local msg = "cursor-tab: Cursor client " .. (client.state or "not initialized")
+		if status.init_error then
+			msg = msg .. ": " .. status.init_error
+		end
+		return msg .. " (" .. (client.attempts or 0) .. " attempts, retrying in the background)"
+	end
+
+	local cursor = status.cursor
+	local lines = { "cursor-tab status", "credentials: " .. cursor.credential_source }
+	if cursor.token then
+		local expiry = cursor.token.expired and "expired" or ("expires in " .. (cursor.token.expires_in or "?"))
+		table.insert(lines, "account: " .. cursor.token.subject .. " (" .. expiry .. ")")
+	elseif cursor.token_error then
+		table.insert(lines, "token: " .. cursor.token_error)
+	end
+	table.insert(lines, "cursor version: " .. cursor.client_version)
+	table.insert(lines, "machine id: " .. (cursor.machine_id_present and "present" or "missing"))
+	table.insert(lines, "upstream: " .. cursor.base_url)
+	if cursor.breaker and cursor.breaker.state ~= "closed" then
+		table.insert(
+			lines,
+			"circuit breaker: " .. cursor.breaker.state .. " (" .. cursor.breaker.consecutive_failures .. " consecutive failures)"
+		)
+	end
+	if cursor.latency and cursor.latency.requests > 0 then
+		table.insert(
+			lines,
+			"first chunk: "
+				.. (cursor.latency.avg_first_chunk_warm or "-")
+				.. " warm, "
+				.. (cursor.latency.avg_first_chunk_cold or "-")
+				.. " cold (connect "
+				.. (cursor.latency.avg_connect_cold or "-")
+				.. ")"
+		)
+	end
+	if cursor.last_error then
+		table.insert(lines, "last error: " .. cursor.last_error.message)
+	end
+	if status.race then
+		table.insert(lines, M.format_race(status.race))
+	end
+	return table.concat(lines, "\n")
+end
+
+function M.show_status()
+	if not M.server_ready or not M.server_url then
+		vim.notify("cursor-tab: server is not running", vim.log.levels.WARN)
+		return
+	end
+
+	vim.fn.jobstart({ "curl", "-s", M.server_url .. "/status" }, {
+		on_stdout = function(_, data)
+			local ok, status = pcall(vim.fn.json_decode, table.concat(data or {}, "\n"))
+			if not ok or type(status) ~= "table" then
+				vim.notify("cursor-tab: could not read server status", vim.log.levels.ERROR)
+				return
+			end
+
+			local level = vim.log.levels.INFO
+			if not status.initialized or status.cursor.last_error then
+				level = vim.log.levels.WARN
+			end
+			vim.notify(M.format_status(status), level)
+		end,
+		stdout_buffered = true,
+	})
+end
+
+-- POST a JSON body through curl's stdin, which unlike argv has no size limit
+function M.post_json(path, body, callback)
+	local job = vim.fn.jobstart({
+		"curl",
+		"-s",
+		"-X",
+		"POST",
+		"-H",
+		"Content-Type: application/json",
+		"--data-binary",
+		"@-",
+		M.server_url .. path,
+	}, {
+		on_stdout = function(_, data)
+			local ok, response = pcall(vim.fn.json_decode, table.concat(data or {}, "\n"))
+			if callback then
+				callback(ok and response or nil)
+			end
+		end,
+		stdout_buffered = true,
+	})
+	if job <= 0 then
+		if callback then
+			callback(nil)
+		end
+		return
+	end
+	vim.fn.chansend(job, vim.fn.json_encode(body))
+	vim.fn.chanclose(job, "stdin")
+end
+
+-- Track a file buffer's edits so suggestion requests need not carry the whole file
+function M.attach_document(bufnr)
+	if M.documents[bufnr] or vim.bo[bufnr].buftype ~= "" then
+		return
+	end
+	local name = vim.api.nvim_buf_get_name(bufnr)
+	if name == "" then
+		return
+	end
+
+	M.documents[bufnr] = {
+		file_path = vim.fn.fnamemodify(name, ":p"),
+		workspace_path = vim.fn.getcwd(),
+		version = 0,
+		pending = {},
+		needs_open = true,
+		syncing = false,
+		waiters = {},
+	}
+
+	vim.api.nvim_buf_attach(bufnr, false, {
+		on_lines = function(_, buf, _, first, last, new_last)
+			local doc = M.documents[buf]
+			if not doc then
+				return true
+			end
+			if doc.needs_open then
+				return
+			end
+
+			table.insert(doc.pending, M.lines_change(buf, first, last, new_last))
+			if #doc.pending > M.max_pending_changes then
+				doc.pending = {}
+				doc.needs_open = true
+			end
+		end,
+		on_reload = function(_, buf)
+			local doc = M.documents[buf]
+			if doc then
+				doc.pending = {}
+				doc.needs_open = true
+			end
+		end,
+		on_detach = function(_, buf)
+			M.documents[buf] = nil
+		end,
+	})
+end
+
+-- Turn an on_lines notification (lines [first, last) replaced by [first, new_last))
+-- into a ranged edit of the buffer text, whose lines are joined without a final newline
+function M.lines_change(bufnr, first, last, new_last)
+	local new_lines = vim.api.nvim_buf_get_lines(bufnr, first, new_last, false)
+	local old_count = vim.api.nvim_buf_line_count(bufnr) - (new_last - last)
+	local text = table.concat(new_lines, "\n")
+
+	if last < old_count then
+		-- Lines before the last: replace whole lines including their newlines
+		if #new_lines > 0 then
+			text = text .. "\n"
+		end
+		return {
+			range = { start = { line = first, character = 0 }, ["end"] = { line = last, character = 0 } },
+			text = text,
+		}
+	end
+
+	if first == 0 then
+		return { text = text }
+	end
+	-- Up to the end of the buffer: start from the end of the line before, which the
+	-- server clamps to
+	if #new_lines > 0 then
+		text = "\n" .. text
+	end
+	return {
+		range = {
+			start = { line = first - 1, character = 2147483647 },
+			["end"] = { line = old_count, character = 0 },
+		},
+		text = text,
+	}
+end
+
+function M.close_document(bufnr)
+	local doc = M.documents[bufnr]
+	if not doc then
+		return
+	end
+	M.documents[bufnr] = nil
+	if M.server_ready and M.server_url and not doc.needs_open then
+		M.post_json("/document/close", { workspace_path = doc.workspace_path, file_path = doc.file_path })
+	end
+end
+
+-- Bring the server's copy of a buffer up to date, then call callback with the synced
+-- version, or nil if the buffer has to be sent in full
+function M.sync_document(bufnr, callback)
+	local doc = M.documents[bufnr]
+	if not doc then
+		callback(nil)
+		return
+	end
+	if doc.syncing then
+		table.insert(doc.waiters, callback)
+		return
+	end
+
+	local path, body
+	if doc.needs_open then
+		path = "/document/open"
+		body = {
+			workspace_path = doc.workspace_path,
+			file_path = doc.file_path,
+			language_id = vim.bo[bufnr].filetype,
+			version = doc.version + 1,
+			contents = table.concat(vim.api.nvim_buf_get_lines(bufnr, 0, -1, false), "\n"),
+		}
+	elseif #doc.pending > 0 then
+		path = "/document/change"
+		body = {
+			workspace_path = doc.workspace_path,
+			file_path = doc.file_path,
+			version = doc.version + 1,
+			changes = doc.pending,
+		}
+	else
+		callback(doc.version)
+		return
+	end
+
+	-- Edits made while the request is in flight queue up against the new version
+	doc.version = body.version
+	doc.pending = {}
+	doc.needs_open = false
+	doc.syncing = true
+
+	M.post_json(path, body, function(response)
+		doc.syncing = false
+		local ok = response and not response.error
+		if not ok then
+			doc.pending = {}
+			doc.needs_open = true
+		end
+		if M.documents[bufnr] == doc then
+			callback(ok and doc.version or nil)
+		else
+			callback(nil)
+		end
+
+		local waiters = doc.waiters
+		doc.waiters = {}
+		for _, waiter in ipairs(waiters) do
+			M.sync_document(bufnr, waiter)
+		end
+	end)
+end
+
 function M.get_suggestion(suggestion_id, callback)
 	if not M.ensure_server() then
 		if callback then
@@ -233,56 +575,174 @@ function M.get_suggestion(suggestion_id, callback)
 		local workspace_path = vim.fn.getcwd()
 
 		local req = {
-			file_contents = table.concat(vim.api.nvim_buf_get_lines(bufnr, 0, -1, false), "\n"),
 			line = line,
 			column = col,
 			file_path = vim.fn.expand("%:p"),
 			language_id = vim.bo.filetype,
 			workspace_path = workspace_path,
 		}
+		if M.send_diagnostics then
+			req.diagnostics = M.get_diagnostics(bufnr)
+		end
 
-		local json_data = vim.fn.json_encode(req)
+		M.request_seq = (M.request_seq or 0) + 1
+		local seq = M.request_seq
+		M.sync_document(bufnr, function(version)
+			-- A newer request was made while the document synced
+			if seq ~= M.request_seq then
+				return
+			end
+			local doc = M.documents[bufnr]
+			if version and doc then
+				req.version = version
+				req.file_path = doc.file_path
+				req.workspace_path = doc.workspace_path
+			else
+				req.file_contents = table.concat(vim.api.nvim_buf_get_lines(bufnr, 0, -1, false), "\n")
+			end
+			M.post_suggestion(req, doc, callback)
+		end)
+	end
+end
 
-		M.pending_job = vim.fn.jobstart({
-			"curl",
-			"-s",
-			"-X",
-			"POST",
-			"-H",
-			"Content-Type: application/json",
-			"-d",
-			json_data,
-			M.server_url .. "/suggestion/new",
-		}, {
-			on_stdout = function(_, data)
-				if not data or #data == 0 then
-					return
-				end
+-- Report open buffers shortly after the last of a burst of scroll and buffer events
+function M.schedule_buffers_report()
+	if M.buffers_timer then
+		vim.fn.timer_stop(M.buffers_timer)
+	end
+	M.buffers_timer = vim.fn.timer_start(200, function()
+		M.buffers_timer = nil
+		M.send_buffers_report()
+	end)
+end
 
-				local response_text = table.concat(data, "\n")
-				if response_text == "" then
-					return
-				end
+-- Tell the server which file buffers are open and which lines of them are on screen.
+-- Visible lines are included unless the server has an up to date synced copy
+function M.send_buffers_report()
+	if not M.server_ready or not M.server_url then
+		return
+	end
 
-				local ok, response = pcall(vim.fn.json_decode, response_text)
-				if ok and response and response.suggestion then
-					if callback then
-						callback(response.suggestion, response.range_replace, response.next_suggestion_id, response.should_remove_leading_eol)
-					end
-				else
-					if callback then
-						callback(nil, nil, nil, false)
-					end
+	local visible = {}
+	for _, win in ipairs(vim.api.nvim_tabpage_list_wins(0)) do
+		local buf = vim.api.nvim_win_get_buf(win)
+		local range = vim.api.nvim_win_call(win, function()
+			return { start_line = vim.fn.line("w0"), end_line = vim.fn.line("w$") }
+		end)
+		visible[buf] = visible[buf] or {}
+		table.insert(visible[buf], range)
+	end
+
+	local buffers = {}
+	for _, buf in ipairs(vim.api.nvim_list_bufs()) do
+		local name = vim.api.nvim_buf_get_name(buf)
+		if vim.bo[buf].buflisted and vim.bo[buf].buftype == "" and name ~= "" then
+			local doc = M.documents[buf]
+			local synced = doc and not doc.needs_open and #doc.pending == 0
+			local ranges = visible[buf]
+			for _, range in ipairs(ranges or {}) do
+				if not synced then
+					range.lines = vim.api.nvim_buf_get_lines(buf, range.start_line - 1, range.end_line, false)
 				end
+			end
+			table.insert(buffers, {
+				file_path = doc and doc.file_path or vim.fn.fnamemodify(name, ":p"),
+				visible_ranges = ranges,
+			})
+		end
+	end
 
-				M.pending_job = nil
-			end,
-			on_exit = function()
-				M.pending_job = nil
-			end,
-			stdout_buffered = true,
-		})
+	M.post_json("/workspace/buffers", { workspace_path = vim.fn.getcwd(), buffers = buffers })
+end
+
+-- Diagnostics of a buffer in the server's format; LSP related information is kept
+-- when it points into the same file
+function M.get_diagnostics(bufnr)
+	local name = vim.api.nvim_buf_get_name(bufnr)
+	local uri = name ~= "" and vim.uri_from_fname(name) or nil
+	local diagnostics = {}
+
+	for _, d in ipairs(vim.diagnostic.get(bufnr)) do
+		local diagnostic = {
+			message = d.message,
+			source = d.source,
+			severity = d.severity,
+			range = {
+				start = { line = d.lnum, column = d.col },
+				["end"] = { line = d.end_lnum or d.lnum, column = d.end_col or d.col },
+			},
+		}
+
+		local lsp = d.user_data and d.user_data.lsp
+		for _, info in ipairs(lsp and lsp.relatedInformation or {}) do
+			if info.location and info.location.uri == uri then
+				local range = info.location.range
+				diagnostic.related = diagnostic.related or {}
+				table.insert(diagnostic.related, {
+					message = info.message,
+					range = {
+						start = { line = range.start.line, column = range.start.character },
+						["end"] = { line = range["end"].line, column = range["end"].character },
+					},
+				})
+			end
+		end
+
+		table.insert(diagnostics, diagnostic)
 	end
+
+	if #diagnostics == 0 then
+		return nil
+	end
+	return diagnostics
+end
+
+function M.post_suggestion(req, doc, callback)
+	local json_data = vim.fn.json_encode(req)
+
+	M.pending_job = vim.fn.jobstart({
+		"curl",
+		"-s",
+		"-X",
+		"POST",
+		"-H",
+		"Content-Type: application/json",
+		"-d",
+		json_data,
+		M.server_url .. "/suggestion/new",
+	}, {
+		on_stdout = function(_, data)
+			if not data or #data == 0 then
+				return
+			end
+
+			local response_text = table.concat(data, "\n")
+			if response_text == "" then
+				return
+			end
+
+			local ok, response = pcall(vim.fn.json_decode, response_text)
+			if ok and response and response.error_code == "version_mismatch" and doc then
+				doc.pending = {}
+				doc.needs_open = true
+			end
+			if ok and response and response.suggestion then
+				if callback then
+					callback(response.suggestion, response.range_replace, response.next_suggestion_id, response.should_remove_leading_eol)
+				end
+			else
+				if callback then
+					callback(nil, nil, nil, false)
+				end
+			end
+
+			M.pending_job = nil
+		end,
+		on_exit = function()
+			M.pending_job = nil
+		end,
+		stdout_buffered = true,
+	})
 end
 
 function M.show_suggestion(suggestion_id)